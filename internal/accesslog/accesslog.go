@@ -0,0 +1,201 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"proxymity/internal/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields logged when the configuration does not list any, in this order
+var DefaultFields = []string{
+	"time", "request_id", "client_ip", "method", "host", "path", "status",
+	"bytes_in", "bytes_out", "upstream", "backend", "upstream_latency_ms",
+	"latency_ms", "retries",
+}
+
+// Logger writes one structured line per request to every sink
+type Logger struct {
+	format string
+	fields []string
+	sinks  []io.Writer
+	mu     sync.Mutex
+}
+
+// Builds a logger and opens its sinks
+func New(cfg config.AccessLogConfig) (*Logger, error) {
+	l := &Logger{
+		format: cfg.Format,
+		fields: cfg.Fields,
+	}
+	if len(l.fields) == 0 {
+		l.fields = DefaultFields
+	}
+
+	for _, f := range l.fields {
+		if (&Entry{}).value(f) == nil {
+			return nil, fmt.Errorf("unknown access log field %q", f)
+		}
+	}
+
+	for _, scfg := range cfg.Sinks {
+		sink, err := openSink(scfg)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.sinks = append(l.sinks, sink)
+	}
+
+	return l, nil
+}
+
+// Closes the files and sockets the logger opened, stdout stays open
+func (l *Logger) Close() error {
+	var errs []error
+	for _, s := range l.sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("closing access log sinks: %v", errs)
+	}
+	return nil
+}
+
+// Entry is everything known about a request once it has been served
+type Entry struct {
+	Time            time.Time
+	RequestID       string
+	ClientIP        string
+	Method          string
+	Host            string
+	Path            string
+	Status          int
+	BytesIn         int64
+	BytesOut        int64
+	Upstream        string
+	Backend         string
+	UpstreamLatency time.Duration
+	Latency         time.Duration
+	Retries         int
+}
+
+func (e *Entry) value(field string) any {
+	switch field {
+	case "time":
+		return e.Time.Format(time.RFC3339Nano)
+	case "request_id":
+		return e.RequestID
+	case "client_ip":
+		return e.ClientIP
+	case "method":
+		return e.Method
+	case "host":
+		return e.Host
+	case "path":
+		return e.Path
+	case "status":
+		return e.Status
+	case "bytes_in":
+		return e.BytesIn
+	case "bytes_out":
+		return e.BytesOut
+	case "upstream":
+		return e.Upstream
+	case "backend":
+		return e.Backend
+	case "upstream_latency_ms":
+		return float64(e.UpstreamLatency) / float64(time.Millisecond)
+	case "latency_ms":
+		return float64(e.Latency) / float64(time.Millisecond)
+	case "retries":
+		return e.Retries
+	}
+	return nil
+}
+
+// Writes the entry to every sink. Write errors are dropped, logging must never fail a request.
+func (l *Logger) Log(e *Entry) {
+	var line []byte
+	if l.format == "logfmt" {
+		line = l.logfmt(e)
+	} else {
+		line = l.json(e)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.sinks {
+		_, _ = s.Write(line)
+	}
+}
+
+// Encodes the configured fields as a JSON object, keeping their configured order
+func (l *Logger) json(e *Entry) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range l.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f)
+		value, _ := json.Marshal(e.value(f))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// Encodes the configured fields as key=value pairs, quoting values that need it
+func (l *Logger) logfmt(e *Entry) []byte {
+	var buf bytes.Buffer
+	for i, f := range l.fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f)
+		buf.WriteByte('=')
+
+		s := fmt.Sprint(e.value(f))
+		if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// Counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Wraps the request body so the bytes actually received can be reported
+func countBody(r *http.Request) *countingBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
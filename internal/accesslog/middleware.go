@@ -0,0 +1,43 @@
+package accesslog
+
+import (
+	"proxymity/internal/forwarded"
+	"proxymity/internal/requestid"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware logs every request once it has been served
+func (l *Logger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// Keep what the client asked for, routes may rewrite the path before forwarding
+		host, path := c.Request.Host, c.Request.URL.Path
+
+		body := countBody(c.Request)
+		req, rec := Attach(c.Request)
+		c.Request = req
+
+		c.Next()
+
+		e := &Entry{
+			Time:      start,
+			RequestID: requestid.FromContext(c.Request.Context()),
+			ClientIP:  forwarded.ClientIP(c.Request),
+			Method:    c.Request.Method,
+			Host:      host,
+			Path:      path,
+			Status:    c.Writer.Status(),
+			BytesOut:  int64(max(c.Writer.Size(), 0)),
+			Latency:   time.Since(start),
+		}
+		if body != nil {
+			e.BytesIn = body.n
+		}
+		rec.fill(e)
+
+		l.Log(e)
+	}
+}
@@ -0,0 +1,68 @@
+package accesslog
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record collects what the proxy learns about a request while serving it, things the HTTP
+// framework cannot see such as the backend that answered
+type Record struct {
+	mu              sync.Mutex
+	upstream        string
+	backend         string
+	upstreamLatency time.Duration
+	retries         int
+}
+
+type recordKey struct{}
+
+// Returns a shallow copy of r carrying a fresh record
+func Attach(r *http.Request) (*http.Request, *Record) {
+	rec := &Record{}
+	return r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)), rec
+}
+
+// Returns the record attached to the request context, nil when logging is off. Every
+// Record method accepts a nil receiver.
+func FromContext(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// Sets the upstream group serving the request
+func (rec *Record) SetUpstream(name string) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.upstream = name
+}
+
+// Records an attempt against a backend. Every attempt after the first counts as a retry and
+// the latency reported is the one of the last attempt.
+func (rec *Record) Attempt(backend string, latency time.Duration) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.backend != "" {
+		rec.retries++
+	}
+	rec.backend = backend
+	rec.upstreamLatency = latency
+}
+
+func (rec *Record) fill(e *Entry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	e.Upstream = rec.upstream
+	e.Backend = rec.backend
+	e.UpstreamLatency = rec.upstreamLatency
+	e.Retries = rec.retries
+}
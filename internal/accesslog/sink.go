@@ -0,0 +1,152 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"proxymity/internal/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix appended to rotated log files
+const backupTimeFormat = "20060102T150405.000"
+
+func openSink(cfg config.AccessLogSinkConfig) (io.Writer, error) {
+	switch cfg.Type {
+	case "stdout":
+		// Hide the Close method, the process keeps its stdout when the logger is closed
+		return struct{ io.Writer }{os.Stdout}, nil
+
+	case "file":
+		return newRotatingFile(cfg.Path, int64(cfg.MaxSize)*1024*1024, time.Duration(cfg.MaxAge)*24*time.Hour, cfg.MaxBackups)
+
+	case "syslog":
+		return newSyslog(cfg.Network, cfg.Address, cfg.Tag)
+	}
+
+	return nil, fmt.Errorf("unknown access log sink type %q", cfg.Type)
+}
+
+// A log file rotated once it exceeds maxSize bytes. Rotated files are renamed with a
+// timestamp suffix and removed once older than maxAge or beyond the newest maxBackups.
+// A zero limit disables the corresponding rule.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	// Rotations may be rare on a quiet log, apply the age limit to the files left from earlier runs
+	rf.prune()
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+// Must be called with rf.mu held
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	backup := rf.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+
+	rf.prune()
+	return rf.open()
+}
+
+// Removes the rotated files that fall outside the age and count limits. Only files named by
+// rotate are considered, others sharing the prefix are left alone.
+func (rf *rotatingFile) prune() {
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+
+	backups := matches[:0]
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, rf.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	// Timestamp suffixes sort chronologically, newest first after reversing
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, b := range backups {
+		expired := false
+		if rf.maxAge > 0 {
+			if info, err := os.Stat(b); err == nil && time.Since(info.ModTime()) > rf.maxAge {
+				expired = true
+			}
+		}
+
+		if expired || (rf.maxBackups > 0 && i >= rf.maxBackups) {
+			os.Remove(b)
+		}
+	}
+}
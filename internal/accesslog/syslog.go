@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+
+package accesslog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// Connects to a syslog daemon. An empty network and address use the local syslog socket.
+func newSyslog(network, address, tag string) (io.Writer, error) {
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package accesslog
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslog(network, address, tag string) (io.Writer, error) {
+	return nil, errors.New("syslog access log sink is not supported on this platform")
+}
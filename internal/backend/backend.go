@@ -1,8 +1,13 @@
 package backend
 
 import (
+	"log"
 	"net/url"
+	"proxymity/internal/headers"
+	"proxymity/internal/metrics"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Backend struct {
@@ -16,13 +21,37 @@ type Backend struct {
 	// Path to the health check endpoint with /. Default to /health. If root path, insert /
 	Health string
 
-	// Define if will receive requests regardless of being alive or not
-	Enabled bool
+	// Failover tier of the backend. Lower values are preferred, backups use higher ones
+	Priority int
+
+	// Locality label used by zone-aware routing
+	Zone string
+
+	// Header rules applied to requests sent to and responses received from this backend
+	Headers *headers.Rules
 
 	alive  bool
+	state  AdminState
 	conns  int
 	weight int
+	active int64
 	mu     sync.Mutex
+
+	latency      float64
+	latencyStamp time.Time
+	latencyDecay time.Duration
+
+	slowStart time.Duration
+	rampStart time.Time
+
+	breaker breaker
+	metrics *metrics.Metrics
+
+	ejectedUntil time.Time
+	ejections    int
+
+	// Called when the backend flips between alive and dead, changes admin state, its circuit opens or closes or it is ejected
+	onChange func()
 }
 
 // Returns the current live state of the backendU+
@@ -35,8 +64,17 @@ func (b *Backend) IsAlive() bool {
 // Updates the live state of the backend
 func (b *Backend) SetAlive(alive bool) {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	changed := b.alive != alive
 	b.alive = alive
+	if changed && alive {
+		b.startRamp()
+	}
+	onChange := b.onChange
+	b.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange()
+	}
 }
 
 // Return the current number of connections the backend has stabilished in his lifetime
@@ -53,9 +91,34 @@ func (b *Backend) AddConnection() {
 	b.conns++
 }
 
+// Marks a request as dispatched to the backend. Every call must be paired with EndRequest
+func (b *Backend) StartRequest() {
+	atomic.AddInt64(&b.active, 1)
+	b.AddConnection()
+}
+
+// Marks a previously dispatched request as finished, whether it succeeded, failed or was aborted
+func (b *Backend) EndRequest() {
+	if atomic.AddInt64(&b.active, -1) == 0 && b.AdminState() == StateDraining {
+		log.Printf("Backend %s drained", b.Name)
+	}
+}
+
+// Returns the number of requests currently in flight to the backend
+func (b *Backend) ActiveRequests() int64 {
+	return atomic.LoadInt64(&b.active)
+}
+
 // Returns the connection bias wieght from that specific backend
 func (b *Backend) GetWeight() int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	return b.weight
 }
+
+// Sets the connection bias weight of the backend
+func (b *Backend) SetWeight(weight int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.weight = weight
+}
@@ -0,0 +1,259 @@
+package backend
+
+import (
+	"log"
+	"proxymity/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CircuitState is the state of a backend's circuit breaker
+type CircuitState string
+
+const (
+	// Requests flow normally while failures are counted
+	CircuitClosed CircuitState = "closed"
+
+	// Requests are turned away until the open duration elapses
+	CircuitOpen CircuitState = "open"
+
+	// A limited number of probe requests decide whether the circuit closes again
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// BreakerSettings controls when a backend's circuit opens and how it recovers
+type BreakerSettings struct {
+	ConsecutiveFailures int           // Failures in a row that open the circuit
+	FailureRatio        float64       // Failed share of the window's requests that opens the circuit
+	MinRequests         int           // Requests the window needs before the failure ratio applies
+	Window              time.Duration // Rolling window the failure ratio is measured over
+	OpenDuration        time.Duration // Time the circuit stays open before probing the backend
+	HalfOpenRequests    int           // Concurrent probes allowed while half-open, all must succeed to close
+}
+
+type breaker struct {
+	mu          sync.Mutex
+	settings    BreakerSettings
+	state       CircuitState
+	openedAt    time.Time
+	consecutive int
+	buckets     []breakerBucket
+	probes      int
+	successes   int
+	trips       int64
+	rejected    int64
+}
+
+type breakerBucket struct {
+	second   int64
+	requests int
+	failures int
+}
+
+// Sets the circuit breaker settings and closes the circuit
+func (b *Backend) SetCircuitBreaker(s BreakerSettings) {
+	seconds := int(s.Window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+	b.breaker.settings = s
+	b.breaker.state = CircuitClosed
+	b.breaker.consecutive = 0
+	b.breaker.buckets = make([]breakerBucket, seconds)
+}
+
+// Returns the state of the backend's circuit breaker
+func (b *Backend) CircuitState() CircuitState {
+	b.breaker.mu.Lock()
+	defer b.breaker.mu.Unlock()
+	return b.breaker.current()
+}
+
+// Returns how many times the circuit opened and how many requests it turned away
+func (b *Backend) CircuitStats() (int64, int64) {
+	return atomic.LoadInt64(&b.breaker.trips), atomic.LoadInt64(&b.breaker.rejected)
+}
+
+// Reports whether the circuit would let a request through right now, without reserving
+// anything. Balancers use it to leave backends with an open circuit out of rotation.
+func (b *Backend) CircuitReady() bool {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	switch br.current() {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return br.probes < br.halfOpenRequests()
+	}
+	return true
+}
+
+// Asks the circuit to let a request through. The second result tells whether the request is
+// a half-open probe. Every admitted request must be followed by ReportResult or ReleaseAdmission.
+func (b *Backend) Admit() (bool, bool) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	switch br.current() {
+	case CircuitOpen:
+		br.reject(b.metrics)
+		return false, false
+
+	case CircuitHalfOpen:
+		if br.state == CircuitOpen {
+			br.state = CircuitHalfOpen
+			br.probes, br.successes = 0, 0
+		}
+		if br.probes >= br.halfOpenRequests() {
+			br.reject(b.metrics)
+			return false, false
+		}
+		br.probes++
+		return true, true
+	}
+	return true, false
+}
+
+// Feeds the outcome of an admitted request into the circuit breaker
+func (b *Backend) ReportResult(success, probe bool) {
+	br := &b.breaker
+	br.mu.Lock()
+
+	changed, tripped := false, false
+	switch {
+	case probe && br.state == CircuitHalfOpen:
+		br.probes--
+		if !success {
+			br.trip(b.Name, b.metrics)
+			changed, tripped = true, true
+			break
+		}
+		br.successes++
+		if br.successes >= br.halfOpenRequests() {
+			br.state = CircuitClosed
+			br.consecutive = 0
+			clear(br.buckets)
+			changed = true
+			log.Printf("Backend %s circuit closed", b.Name)
+		}
+
+	case !probe && br.current() == CircuitClosed:
+		bk := br.bucket()
+		bk.requests++
+		if success {
+			br.consecutive = 0
+			break
+		}
+		bk.failures++
+		br.consecutive++
+
+		if br.overThreshold() {
+			br.trip(b.Name, b.metrics)
+			changed, tripped = true, true
+		}
+	}
+
+	openDuration := br.settings.OpenDuration
+	onChange := b.onChange
+	br.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange()
+
+		// Balancers caching their candidates need to hear when the open circuit starts probing
+		if tripped {
+			time.AfterFunc(openDuration, onChange)
+		}
+	}
+}
+
+// Gives back an admission whose request ended without telling anything about the backend,
+// such as a client hanging up
+func (b *Backend) ReleaseAdmission(probe bool) {
+	br := &b.breaker
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	if probe && br.state == CircuitHalfOpen {
+		br.probes--
+	}
+}
+
+// Returns the state as seen by callers: an open circuit whose duration elapsed is half-open.
+// Must be called with br.mu held.
+func (br *breaker) current() CircuitState {
+	switch {
+	case br.state == "":
+		return CircuitClosed
+	case br.state == CircuitOpen && time.Since(br.openedAt) >= br.settings.OpenDuration:
+		return CircuitHalfOpen
+	}
+	return br.state
+}
+
+// Opens the circuit. Must be called with br.mu held.
+func (br *breaker) trip(name string, m *metrics.Metrics) {
+	log.Printf("Backend %s circuit opened for %s", name, br.settings.OpenDuration)
+	br.state = CircuitOpen
+	br.openedAt = time.Now()
+	br.probes = 0
+	atomic.AddInt64(&br.trips, 1)
+	if m != nil {
+		atomic.AddInt64(&m.CircuitBreaker.Trips, 1)
+	}
+}
+
+// Must be called with br.mu held
+func (br *breaker) reject(m *metrics.Metrics) {
+	atomic.AddInt64(&br.rejected, 1)
+	if m != nil {
+		atomic.AddInt64(&m.CircuitBreaker.Rejected, 1)
+	}
+}
+
+// Reports whether the failures seen while closed warrant opening the circuit. Must be
+// called with br.mu held.
+func (br *breaker) overThreshold() bool {
+	if br.settings.ConsecutiveFailures > 0 && br.consecutive >= br.settings.ConsecutiveFailures {
+		return true
+	}
+
+	oldest := time.Now().Unix() - int64(len(br.buckets))
+	requests, failures := 0, 0
+	for _, bk := range br.buckets {
+		if bk.second > oldest {
+			requests += bk.requests
+			failures += bk.failures
+		}
+	}
+
+	return br.settings.FailureRatio > 0 && requests >= max(br.settings.MinRequests, 1) &&
+		float64(failures) >= br.settings.FailureRatio*float64(requests)
+}
+
+// Returns the bucket of the current second, recycling it if it holds an expired second. Must
+// be called with br.mu held.
+func (br *breaker) bucket() *breakerBucket {
+	if len(br.buckets) == 0 {
+		br.buckets = make([]breakerBucket, 1)
+	}
+
+	now := time.Now().Unix()
+	bk := &br.buckets[now%int64(len(br.buckets))]
+	if bk.second != now {
+		*bk = breakerBucket{second: now}
+	}
+	return bk
+}
+
+// Must be called with br.mu held
+func (br *breaker) halfOpenRequests() int {
+	return max(br.settings.HalfOpenRequests, 1)
+}
@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+// One step of a breaker scenario: "ok" and "fail" report a regular request, "probe-ok" and
+// "probe-fail" a half-open probe, "admit" asks for an admission, "release" gives back a probe
+// admission and "elapse" lets the open duration pass
+type breakerStep struct {
+	do        string
+	wantAdmit bool
+	wantProbe bool
+	want      CircuitState
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     BreakerSettings
+		steps        []breakerStep
+		wantTrips    int64
+		wantRejected int64
+	}{
+		{
+			name:     "consecutive failures",
+			settings: BreakerSettings{ConsecutiveFailures: 3, OpenDuration: time.Minute},
+			steps: []breakerStep{
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitOpen},
+				{do: "admit", want: CircuitOpen},
+				{do: "admit", want: CircuitOpen},
+			},
+			wantTrips:    1,
+			wantRejected: 2,
+		},
+		{
+			name:     "failure ratio over the window",
+			settings: BreakerSettings{FailureRatio: 0.5, MinRequests: 4, Window: time.Minute, OpenDuration: time.Minute},
+			steps: []breakerStep{
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "fail", want: CircuitOpen},
+			},
+			wantTrips: 1,
+		},
+		{
+			name:     "ratio below the threshold",
+			settings: BreakerSettings{FailureRatio: 0.5, MinRequests: 2, Window: time.Minute, OpenDuration: time.Minute},
+			steps: []breakerStep{
+				{do: "ok", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "ok", want: CircuitClosed},
+				{do: "fail", want: CircuitClosed},
+				{do: "fail", want: CircuitOpen},
+			},
+			wantTrips: 1,
+		},
+		{
+			name:     "probes close the circuit",
+			settings: BreakerSettings{ConsecutiveFailures: 1, OpenDuration: time.Minute, HalfOpenRequests: 2},
+			steps: []breakerStep{
+				{do: "fail", want: CircuitOpen},
+				{do: "elapse", want: CircuitHalfOpen},
+				{do: "admit", wantAdmit: true, wantProbe: true, want: CircuitHalfOpen},
+				{do: "admit", wantAdmit: true, wantProbe: true, want: CircuitHalfOpen},
+				{do: "admit", want: CircuitHalfOpen},
+				{do: "probe-ok", want: CircuitHalfOpen},
+				{do: "probe-ok", want: CircuitClosed},
+				{do: "admit", wantAdmit: true, want: CircuitClosed},
+				{do: "fail", want: CircuitOpen},
+			},
+			wantTrips:    2,
+			wantRejected: 1,
+		},
+		{
+			name:     "failed probe reopens",
+			settings: BreakerSettings{ConsecutiveFailures: 1, OpenDuration: time.Minute, HalfOpenRequests: 2},
+			steps: []breakerStep{
+				{do: "fail", want: CircuitOpen},
+				{do: "elapse", want: CircuitHalfOpen},
+				{do: "admit", wantAdmit: true, wantProbe: true, want: CircuitHalfOpen},
+				{do: "probe-fail", want: CircuitOpen},
+				{do: "admit", want: CircuitOpen},
+			},
+			wantTrips:    2,
+			wantRejected: 1,
+		},
+		{
+			name:     "released probe frees its slot",
+			settings: BreakerSettings{ConsecutiveFailures: 1, OpenDuration: time.Minute, HalfOpenRequests: 1},
+			steps: []breakerStep{
+				{do: "fail", want: CircuitOpen},
+				{do: "elapse", want: CircuitHalfOpen},
+				{do: "admit", wantAdmit: true, wantProbe: true, want: CircuitHalfOpen},
+				{do: "admit", want: CircuitHalfOpen},
+				{do: "release", want: CircuitHalfOpen},
+				{do: "admit", wantAdmit: true, wantProbe: true, want: CircuitHalfOpen},
+				{do: "probe-ok", want: CircuitClosed},
+			},
+			wantTrips:    1,
+			wantRejected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		b := &Backend{Name: "b"}
+		b.SetCircuitBreaker(tt.settings)
+
+		for i, s := range tt.steps {
+			switch s.do {
+			case "ok", "fail":
+				b.ReportResult(s.do == "ok", false)
+			case "probe-ok", "probe-fail":
+				b.ReportResult(s.do == "probe-ok", true)
+			case "release":
+				b.ReleaseAdmission(true)
+			case "elapse":
+				b.breaker.mu.Lock()
+				b.breaker.openedAt = b.breaker.openedAt.Add(-tt.settings.OpenDuration)
+				b.breaker.mu.Unlock()
+			case "admit":
+				ready := b.CircuitReady()
+				admit, probe := b.Admit()
+				if admit != s.wantAdmit || probe != s.wantProbe {
+					t.Errorf("%s: step %d: Admit() = %v, %v, want %v, %v", tt.name, i, admit, probe, s.wantAdmit, s.wantProbe)
+				}
+				if ready != admit {
+					t.Errorf("%s: step %d: CircuitReady() = %v but Admit() = %v", tt.name, i, ready, admit)
+				}
+			}
+
+			if got := b.CircuitState(); got != s.want {
+				t.Fatalf("%s: step %d (%s): state = %s, want %s", tt.name, i, s.do, got, s.want)
+			}
+		}
+
+		trips, rejected := b.CircuitStats()
+		if trips != tt.wantTrips || rejected != tt.wantRejected {
+			t.Errorf("%s: trips, rejected = %d, %d, want %d, %d", tt.name, trips, rejected, tt.wantTrips, tt.wantRejected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"log"
+	"time"
+)
+
+// Takes the backend out of rotation for base times the number of times it was ejected in a
+// row, capped at limit, and returns the ejection duration
+func (b *Backend) Eject(base, limit time.Duration, reason string) time.Duration {
+	b.mu.Lock()
+	b.ejections++
+	d := min(base*time.Duration(b.ejections), limit)
+	b.ejectedUntil = time.Now().Add(d)
+	onChange := b.onChange
+	b.mu.Unlock()
+
+	log.Printf("Backend %s ejected for %s: %s", b.Name, d, reason)
+
+	if onChange != nil {
+		onChange()
+
+		// Balancers caching their candidates need to hear when the ejection ends
+		time.AfterFunc(d, onChange)
+	}
+	return d
+}
+
+// Reports whether the backend is currently ejected by outlier detection
+func (b *Backend) IsEjected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.ejectedUntil)
+}
+
+// Returns how many ejections in a row the next ejection duration is based on
+func (b *Backend) Ejections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ejections
+}
+
+// Lowers the ejection count of a backend back in rotation for longer than quiet, so one that
+// stays well behaved returns to short ejections
+func (b *Backend) ForgiveEjection(quiet time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ejections > 0 && time.Since(b.ejectedUntil) >= quiet {
+		b.ejections--
+	}
+}
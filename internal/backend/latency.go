@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"math"
+	"time"
+)
+
+// Time constant used to age latency samples when none is configured
+const DefaultLatencyDecay = 10 * time.Second
+
+// Latency assumed for a backend that has not served any request yet
+const unsampledLatency = time.Millisecond
+
+// Sets the time constant of the latency moving average. Larger values react slower to changes.
+func (b *Backend) SetLatencyDecay(decay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latencyDecay = decay
+}
+
+// Feeds a response time sample into the backend's exponentially weighted moving average.
+// Older samples lose influence based on the time elapsed since the previous observation,
+// while a sample above the current average replaces it outright so that a backend turning
+// slow is penalised immediately and only recovers gradually ("peak EWMA").
+func (b *Backend) ObserveLatency(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	sample := float64(d)
+
+	decay := b.latencyDecay
+	if decay <= 0 {
+		decay = DefaultLatencyDecay
+	}
+
+	if b.latencyStamp.IsZero() || sample > b.latency {
+		b.latency = sample
+	} else {
+		w := math.Exp(-float64(now.Sub(b.latencyStamp)) / float64(decay))
+		b.latency = b.latency*w + sample*(1-w)
+	}
+	b.latencyStamp = now
+}
+
+// Returns the current moving average of the backend's response time, zero if nothing was observed yet
+func (b *Backend) LatencyEWMA() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration(b.latency)
+}
+
+// Returns the peak EWMA cost of the backend: its latency average multiplied by the requests it
+// would have outstanding if it received one more. Lower is better.
+func (b *Backend) Cost() float64 {
+	latency := b.LatencyEWMA()
+	if latency <= 0 {
+		latency = unsampledLatency
+	}
+	return float64(latency) * float64(b.ActiveRequests()+1)
+}
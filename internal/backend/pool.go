@@ -3,27 +3,72 @@ package backend
 import (
 	"fmt"
 	"proxymity/internal/metrics"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
+// Healthy fraction a priority tier needs to keep lower tiers out of rotation when none is configured
+const DefaultFailoverThreshold = 0.5
+
 type Pool struct {
-	backends []*Backend
-	metrics  *metrics.Metrics
-	mu       sync.Mutex
+	backends   []*Backend
+	metrics    *metrics.Metrics
+	mu         sync.Mutex
+	generation uint64
+	threshold  float64
 }
 
 func NewPool(m *metrics.Metrics) *Pool {
 	return &Pool{
-		backends: make([]*Backend, 0),
-		metrics:  m,
+		backends:  make([]*Backend, 0),
+		metrics:   m,
+		threshold: DefaultFailoverThreshold,
 	}
 }
 
+// Sets the healthy fraction (0 to 1) below which a priority tier spills traffic onto the next one
+func (p *Pool) SetFailoverThreshold(threshold float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.threshold = threshold
+}
+
 func (p *Pool) AddBackend(b *Backend) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	b.mu.Lock()
+	b.onChange = p.changed
+	b.metrics = p.metrics
+	b.startRamp()
+	b.mu.Unlock()
+
 	p.backends = append(p.backends, b)
+	p.changed()
+}
+
+func (p *Pool) changed() {
+	atomic.AddUint64(&p.generation, 1)
+}
+
+// Returns a counter that changes every time the pool membership or the health of one of its
+// backends changes, so balancers can tell when precomputed state needs rebuilding
+func (p *Pool) Generation() uint64 {
+	return atomic.LoadUint64(&p.generation)
+}
+
+// Returns the backend with the given name, or nil if the pool has none
+func (p *Pool) GetBackend(name string) *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, b := range p.backends {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
 }
 
 func (p *Pool) GetBackends() []*Backend {
@@ -50,16 +95,13 @@ func (p *Pool) GetHealthyBackends() ([]*Backend, error) {
 }
 
 func (p *Pool) GetAvailableBackends() ([]*Backend, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	healthy, err := p.GetHealthyBackends()
 	if err != nil {
 		return nil, err
 	}
 	available := make([]*Backend, 0)
 	for _, b := range healthy {
-		if b.IsAlive() {
+		if b.servable() {
 			available = append(available, b)
 		}
 	}
@@ -67,5 +109,79 @@ func (p *Pool) GetAvailableBackends() ([]*Backend, error) {
 	if len(available) == 0 {
 		return nil, fmt.Errorf("there are no backends available at the moment, retrying")
 	}
-	return available, nil
+
+	selected := make([]*Backend, 0, len(available))
+	for _, t := range p.tiers(available) {
+		if t.Active {
+			selected = append(selected, t.members...)
+		}
+	}
+	return selected, nil
+}
+
+// Tier groups the backends sharing a priority. Lower priorities are preferred.
+type Tier struct {
+	Priority int
+	Total    int
+	Healthy  int
+	Active   bool
+
+	members []*Backend
+}
+
+// Returns the priority tiers of the pool and whether each one is currently taking traffic
+func (p *Pool) Tiers() []Tier {
+	healthy, _ := p.GetHealthyBackends()
+
+	available := make([]*Backend, 0, len(healthy))
+	for _, b := range healthy {
+		if b.servable() {
+			available = append(available, b)
+		}
+	}
+	return p.tiers(available)
+}
+
+// Splits the pool into tiers and marks the active ones. Tiers are activated in priority order
+// until one has at least the failover threshold of its members available, so a standby tier
+// only receives traffic while every tier above it is degraded.
+func (p *Pool) tiers(available []*Backend) []Tier {
+	p.mu.Lock()
+	threshold := p.threshold
+	byPriority := make(map[int]*Tier)
+	for _, b := range p.backends {
+		// Backends taken out of rotation by an operator do not count against their tier
+		if !b.IsEnabled() {
+			continue
+		}
+
+		t, ok := byPriority[b.Priority]
+		if !ok {
+			t = &Tier{Priority: b.Priority}
+			byPriority[b.Priority] = t
+		}
+		t.Total++
+	}
+	p.mu.Unlock()
+
+	for _, b := range available {
+		if t, ok := byPriority[b.Priority]; ok {
+			t.Healthy++
+			t.members = append(t.members, b)
+		}
+	}
+
+	tiers := make([]Tier, 0, len(byPriority))
+	for _, t := range byPriority {
+		tiers = append(tiers, *t)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Priority < tiers[j].Priority })
+
+	for i := range tiers {
+		tiers[i].Active = true
+		if tiers[i].Healthy > 0 && float64(tiers[i].Healthy) >= threshold*float64(tiers[i].Total) {
+			break
+		}
+	}
+	return tiers
 }
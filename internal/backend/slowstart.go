@@ -0,0 +1,42 @@
+package backend
+
+import "time"
+
+// Share of its weight a backend receives right when its slow-start window begins
+const slowStartFloor = 0.1
+
+// Sets how long a recovered or newly added backend takes to ramp up to its full weight. Zero disables slow start.
+func (b *Backend) SetSlowStart(window time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.slowStart = window
+}
+
+// Restarts the slow-start window. Must be called with b.mu held.
+func (b *Backend) startRamp() {
+	b.rampStart = time.Now()
+}
+
+// Returns the fraction of its weight the backend should currently receive, growing linearly
+// from slowStartFloor to 1 over the slow-start window
+func (b *Backend) RampFactor() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.slowStart <= 0 || b.rampStart.IsZero() {
+		return 1
+	}
+
+	elapsed := time.Since(b.rampStart)
+	if elapsed >= b.slowStart {
+		return 1
+	}
+
+	progress := float64(elapsed) / float64(b.slowStart)
+	return slowStartFloor + (1-slowStartFloor)*progress
+}
+
+// Returns the configured weight scaled by the slow-start ramp
+func (b *Backend) EffectiveWeight() float64 {
+	return float64(max(b.GetWeight(), 1)) * b.RampFactor()
+}
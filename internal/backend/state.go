@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// AdminState is the operator-controlled state of a backend, independent of its health
+type AdminState string
+
+const (
+	// Receives new requests while healthy
+	StateEnabled AdminState = "enabled"
+
+	// Receives no requests at all
+	StateDisabled AdminState = "disabled"
+
+	// Receives no new requests but lets the in-flight ones finish
+	StateDraining AdminState = "draining"
+)
+
+// Parses an admin state name
+func ParseAdminState(s string) (AdminState, error) {
+	switch state := AdminState(s); state {
+	case StateEnabled, StateDisabled, StateDraining:
+		return state, nil
+	}
+	return "", fmt.Errorf("invalid admin state %q, expected enabled, disabled or draining", s)
+}
+
+// Returns the admin state of the backend. Backends start out enabled.
+func (b *Backend) AdminState() AdminState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.adminState()
+}
+
+// Must be called with b.mu held
+func (b *Backend) adminState() AdminState {
+	if b.state == "" {
+		return StateEnabled
+	}
+	return b.state
+}
+
+// Updates the admin state of the backend
+func (b *Backend) SetAdminState(state AdminState) {
+	b.mu.Lock()
+	changed := b.adminState() != state
+	b.state = state
+	if changed && state == StateEnabled && b.alive {
+		b.startRamp()
+	}
+	onChange := b.onChange
+	b.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange()
+	}
+
+	if state == StateDraining && b.Drained() {
+		log.Printf("Backend %s drained", b.Name)
+	}
+}
+
+// Reports whether the backend is accepting new requests
+func (b *Backend) IsEnabled() bool {
+	return b.AdminState() == StateEnabled
+}
+
+// Reports whether a healthy backend may take new requests: it is enabled, its circuit lets
+// requests through and outlier detection has not ejected it
+func (b *Backend) servable() bool {
+	return b.IsEnabled() && b.CircuitReady() && !b.IsEjected()
+}
+
+// Reports whether a draining backend has finished all of its in-flight requests
+func (b *Backend) Drained() bool {
+	return b.AdminState() == StateDraining && atomic.LoadInt64(&b.active) == 0
+}
@@ -1,16 +1,77 @@
 package loadbalancer
 
-import "proxymity/internal/backend"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"proxymity/internal/backend"
+)
 
 // BaseLoadBalancer provides shared logic for all load balancers
 type BaseLoadBalancer struct {
 	pool *backend.Pool
 }
 
-func (b *BaseLoadBalancer) CountAvailableBackends() int {
-	backends, err := b.pool.GetHealthyBackends()
+// Counts the available backends that pass the filters attached to r
+func (b *BaseLoadBalancer) CountAvailableBackends(r *http.Request) int {
+	backends, err := b.available(r)
 	if err != nil {
 		return 0
 	}
 	return len(backends)
 }
+
+// Returns the pool's available backends narrowed down by the filters attached to the request
+func (b *BaseLoadBalancer) available(r *http.Request) ([]*backend.Backend, error) {
+	backends, err := b.pool.GetAvailableBackends()
+	if err != nil {
+		return nil, err
+	}
+	return narrow(r, backends)
+}
+
+// Returns the backends passing the filters attached to r, backends itself when there are none
+func narrow(r *http.Request, backends []*backend.Backend) ([]*backend.Backend, error) {
+	filters, _ := r.Context().Value(filtersKey{}).([]Filter)
+	if len(filters) == 0 {
+		return backends, nil
+	}
+
+	allowed := make([]*backend.Backend, 0, len(backends))
+	for _, be := range backends {
+		if matchesAll(filters, be) {
+			allowed = append(allowed, be)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return nil, errors.New("no available backend matches the request constraints")
+	}
+	return allowed, nil
+}
+
+// Filter reports whether a backend may serve a request
+type Filter func(b *backend.Backend) bool
+
+type filtersKey struct{}
+
+// Returns a shallow copy of r whose backend selection is restricted by f on top of any filter
+// already attached. This lets wrappers narrow the candidates of any balancer.
+func WithFilter(r *http.Request, f Filter) *http.Request {
+	existing, _ := r.Context().Value(filtersKey{}).([]Filter)
+
+	filters := make([]Filter, len(existing), len(existing)+1)
+	copy(filters, existing)
+	filters = append(filters, f)
+
+	return r.WithContext(context.WithValue(r.Context(), filtersKey{}, filters))
+}
+
+func matchesAll(filters []Filter, b *backend.Backend) bool {
+	for _, f := range filters {
+		if !f(b) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package loadbalancer
+
+import (
+	"net/http/httptest"
+	"proxymity/internal/backend"
+	"proxymity/internal/metrics"
+	"testing"
+)
+
+// Returns a pool of alive backends with a weight of one, in the given order
+func newTestPool(names ...string) *backend.Pool {
+	pool := backend.NewPool(metrics.NewMetrics())
+	for _, name := range names {
+		addTestBackend(pool, name, 1)
+	}
+	return pool
+}
+
+func addTestBackend(pool *backend.Pool, name string, weight int) *backend.Backend {
+	b := &backend.Backend{Name: name}
+	b.SetWeight(weight)
+	b.SetAlive(true)
+	pool.AddBackend(b)
+	return b
+}
+
+func TestCountAvailableBackends(t *testing.T) {
+	pool := newTestPool("a", "b", "c")
+	pool.GetBackend("c").SetAlive(false)
+
+	except := func(names ...string) Filter {
+		return func(b *backend.Backend) bool {
+			for _, name := range names {
+				if b.Name == name {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filters []Filter
+		want    int
+	}{
+		{name: "no filter", want: 2},
+		{name: "one excluded", filters: []Filter{except("a")}, want: 1},
+		{name: "stacked filters", filters: []Filter{except("a"), except("b")}, want: 0},
+		{name: "unavailable excluded", filters: []Filter{except("c")}, want: 2},
+	}
+
+	balancers := map[string]LoadBalancer{
+		"round-robin": NewRoundRobin(pool),
+		"p2c":         NewP2C(pool, LoadInFlight),
+		"zone-aware":  NewZoneAware(NewRoundRobin(pool), pool, "z1", 0.7, 1.5),
+	}
+
+	for method, lb := range balancers {
+		for _, tt := range tests {
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, f := range tt.filters {
+				r = WithFilter(r, f)
+			}
+
+			if got := lb.CountAvailableBackends(r); got != tt.want {
+				t.Errorf("%s: %s: CountAvailableBackends() = %d, want %d", method, tt.name, got, tt.want)
+			}
+		}
+	}
+}
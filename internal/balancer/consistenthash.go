@@ -0,0 +1,108 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"proxymity/internal/backend"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type ringPoint struct {
+	hash    uint64
+	backend *backend.Backend
+}
+
+type ConsistentHash struct {
+	BaseLoadBalancer
+	key          KeyFunc
+	virtualNodes int
+
+	mu         sync.RWMutex
+	ring       []ringPoint
+	generation uint64
+	built      bool
+}
+
+func NewConsistentHash(pool *backend.Pool, key KeyFunc, virtualNodes int) *ConsistentHash {
+	return &ConsistentHash{
+		BaseLoadBalancer: BaseLoadBalancer{pool: pool},
+		key:              key,
+		virtualNodes:     virtualNodes,
+	}
+}
+
+// Maps the request key onto the ring and walks clockwise to the first available backend.
+// The ring holds every pool member, healthy or not, so a backend going down only moves
+// the keys it owned. Requests without a key are spread randomly.
+func (ch *ConsistentHash) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := ch.available(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := ch.key(r)
+	if !ok {
+		return backends[rand.Intn(len(backends))], nil
+	}
+
+	available := make(map[*backend.Backend]bool, len(backends))
+	for _, b := range backends {
+		available[b] = true
+	}
+
+	ring := ch.getRing()
+	h := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	for i := 0; i < len(ring); i++ {
+		p := ring[(start+i)%len(ring)]
+		if available[p.backend] {
+			return p.backend, nil
+		}
+	}
+
+	// Available backends that are not on the ring yet, should only happen mid-rebuild
+	return backends[rand.Intn(len(backends))], nil
+}
+
+// Returns the ring, rebuilding it first if the pool membership changed since the last build
+func (ch *ConsistentHash) getRing() []ringPoint {
+	gen := ch.pool.Generation()
+
+	ch.mu.RLock()
+	if ch.built && ch.generation == gen {
+		defer ch.mu.RUnlock()
+		return ch.ring
+	}
+	ch.mu.RUnlock()
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if !ch.built || ch.generation != gen {
+		ch.ring = buildRing(ch.pool.GetBackends(), ch.virtualNodes)
+		ch.generation = gen
+		ch.built = true
+	}
+	return ch.ring
+}
+
+// Places virtualNodes points per unit of weight for every backend and sorts them by hash
+func buildRing(backends []*backend.Backend, virtualNodes int) []ringPoint {
+	ring := make([]ringPoint, 0)
+
+	for _, b := range backends {
+		replicas := virtualNodes * max(b.GetWeight(), 1)
+		for i := 0; i < replicas; i++ {
+			ring = append(ring, ringPoint{
+				hash:    hashKey(b.Name + "#" + strconv.Itoa(i)),
+				backend: b,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
@@ -0,0 +1,106 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Hashes requests on their path
+func pathKey(r *http.Request) (string, bool) {
+	return r.URL.Path, true
+}
+
+// Returns the backend name each of n keys maps to
+func assignments(t *testing.T, lb LoadBalancer, n int) []string {
+	t.Helper()
+
+	names := make([]string, n)
+	for i := range names {
+		b, err := lb.NextBackend(httptest.NewRequest("GET", "/k"+strconv.Itoa(i), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[i] = b.Name
+	}
+	return names
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	const keys = 20000
+
+	tests := []struct {
+		weights map[string]int
+		share   map[string]float64
+	}{
+		{
+			weights: map[string]int{"a": 1, "b": 1, "c": 1, "d": 1},
+			share:   map[string]float64{"a": 0.25, "b": 0.25, "c": 0.25, "d": 0.25},
+		},
+		{
+			weights: map[string]int{"a": 2, "b": 1, "c": 1},
+			share:   map[string]float64{"a": 0.5, "b": 0.25, "c": 0.25},
+		},
+	}
+
+	for _, tt := range tests {
+		pool := newTestPool()
+		for _, name := range []string{"a", "b", "c", "d"} {
+			if w, ok := tt.weights[name]; ok {
+				addTestBackend(pool, name, w)
+			}
+		}
+		ch := NewConsistentHash(pool, pathKey, 160)
+
+		counts := make(map[string]int)
+		for _, name := range assignments(t, ch, keys) {
+			counts[name]++
+		}
+
+		for name, want := range tt.share {
+			got := float64(counts[name]) / keys
+			if got < want*0.8 || got > want*1.2 {
+				t.Errorf("weights %v: %s got %.3f of the keys, want %.3f +/- 20%%", tt.weights, name, got, want)
+			}
+		}
+	}
+}
+
+func TestConsistentHashRemapping(t *testing.T) {
+	const keys = 5000
+
+	pool := newTestPool("a", "b", "c")
+	ch := NewConsistentHash(pool, pathKey, 160)
+	before := assignments(t, ch, keys)
+
+	// Adding a backend only moves keys onto it, about a quarter of them
+	addTestBackend(pool, "d", 1)
+	added := assignments(t, ch, keys)
+
+	moved := 0
+	for i := range before {
+		if added[i] != before[i] {
+			moved++
+			if added[i] != "d" {
+				t.Fatalf("key %d moved from %s to %s, want d", i, before[i], added[i])
+			}
+		}
+	}
+	if share := float64(moved) / keys; share < 0.15 || share > 0.35 {
+		t.Errorf("adding a fourth backend moved %.3f of the keys, want about 0.25", share)
+	}
+
+	// Taking a backend out only moves the keys it owned
+	pool.GetBackend("b").SetAlive(false)
+	removed := assignments(t, ch, keys)
+
+	for i := range added {
+		switch {
+		case added[i] == "b" && removed[i] == "b":
+			t.Fatalf("key %d still maps to the unavailable backend", i)
+		case added[i] != "b" && removed[i] != added[i]:
+			t.Fatalf("key %d moved from %s to %s although its backend stayed up", i, added[i], removed[i])
+		}
+	}
+}
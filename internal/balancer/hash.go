@@ -0,0 +1,78 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"proxymity/internal/forwarded"
+	"strings"
+)
+
+// Extracts the value a request is hashed on. The boolean is false when the request does not carry the key.
+type KeyFunc func(r *http.Request) (string, bool)
+
+// Builds a KeyFunc from its configuration form: "client-ip", "path", "header:<name>",
+// "cookie:<name>" or "query:<name>"
+func ResolveKey(spec string) (KeyFunc, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "client-ip":
+		return func(r *http.Request) (string, bool) {
+			ip := forwarded.ClientIP(r)
+			return ip, ip != ""
+		}, nil
+
+	case "path":
+		return func(r *http.Request) (string, bool) {
+			return r.URL.Path, true
+		}, nil
+
+	case "header":
+		if name == "" {
+			break
+		}
+		return func(r *http.Request) (string, bool) {
+			v := r.Header.Get(name)
+			return v, v != ""
+		}, nil
+
+	case "cookie":
+		if name == "" {
+			break
+		}
+		return func(r *http.Request) (string, bool) {
+			c, err := r.Cookie(name)
+			if err != nil || c.Value == "" {
+				return "", false
+			}
+			return c.Value, true
+		}, nil
+
+	case "query":
+		if name == "" {
+			break
+		}
+		return func(r *http.Request) (string, bool) {
+			v := r.URL.Query().Get(name)
+			return v, v != ""
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid hash key %q", spec)
+}
+
+// 64-bit FNV-1a followed by a splitmix64 finalizer, so that keys differing in a single
+// character still land far apart on the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
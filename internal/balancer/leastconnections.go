@@ -2,12 +2,12 @@ package loadbalancer
 
 import (
 	"math/rand"
+	"net/http"
 	"proxymity/internal/backend"
 )
 
 type LeastConnections struct {
 	BaseLoadBalancer
-	connsMap map[*backend.Backend]int
 }
 
 func NewLeastConnections(pool *backend.Pool) *LeastConnections {
@@ -16,12 +16,33 @@ func NewLeastConnections(pool *backend.Pool) *LeastConnections {
 	}
 }
 
-func (lc *LeastConnections) NextBackend() (*backend.Backend, error) {
-	backends, err := lc.pool.GetAvailableBackends()
+// Picks the backend with the fewest in-flight requests, counting them against the slow-start
+// ramp so a warming backend looks busier than it is. Ties are broken in favour of the heaviest
+// backend, and any remaining ties are resolved randomly so a single node does not absorb every
+// request while the pool is idle.
+func (lc *LeastConnections) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := lc.available(r)
 	if err != nil {
 		return nil, err
 	}
 
-	idx := rand.Intn(len(backends))
-	return backends[idx], nil
+	var (
+		candidates []*backend.Backend
+		minLoad    float64
+		maxWeight  int
+	)
+	for _, b := range backends {
+		load := float64(b.ActiveRequests()+1) / b.RampFactor()
+		weight := b.GetWeight()
+
+		switch {
+		case candidates == nil, load < minLoad, load == minLoad && weight > maxWeight:
+			candidates = append(candidates[:0], b)
+			minLoad, maxWeight = load, weight
+		case load == minLoad && weight == maxWeight:
+			candidates = append(candidates, b)
+		}
+	}
+
+	return candidates[rand.Intn(len(candidates))], nil
 }
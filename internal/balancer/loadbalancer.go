@@ -2,17 +2,24 @@ package loadbalancer
 
 import (
 	"log"
+	"net/http"
 	"proxymity/internal/backend"
+	"proxymity/internal/config"
 	"proxymity/internal/metrics"
 )
 
 type LoadBalancer interface {
-	NextBackend() (*backend.Backend, error)
-	CountAvailableBackends() int
+	NextBackend(r *http.Request) (*backend.Backend, error)
+	CountAvailableBackends(r *http.Request) int
 }
 
-func ResolveMethod(method string, pool *backend.Pool, m *metrics.Metrics) LoadBalancer {
-	switch method {
+// Implemented by balancers that keep internal state worth reporting on the status endpoint
+type StatsReporter interface {
+	Stats() map[string]any
+}
+
+func ResolveMethod(cfg config.LoadBalancerConfig, pool *backend.Pool, m *metrics.Metrics) LoadBalancer {
+	switch cfg.Method {
 	case "round-robin":
 		return NewRoundRobin(pool)
 
@@ -25,6 +32,28 @@ func ResolveMethod(method string, pool *backend.Pool, m *metrics.Metrics) LoadBa
 	case "weighted":
 		return NewWeighted(pool)
 
+	case "p2c":
+		return NewP2C(pool, cfg.LoadSignal)
+
+	case "peak-ewma":
+		return NewPeakEWMA(pool)
+
+	case "consistent-hash":
+		key, err := ResolveKey(cfg.HashKey)
+		if err != nil {
+			log.Printf("Error resolving hash key: %v. Defaulting to round-robin", err)
+			return NewRoundRobin(pool)
+		}
+		return NewConsistentHash(pool, key, int(cfg.VirtualNodes))
+
+	case "maglev":
+		key, err := ResolveKey(cfg.HashKey)
+		if err != nil {
+			log.Printf("Error resolving hash key: %v. Defaulting to round-robin", err)
+			return NewRoundRobin(pool)
+		}
+		return NewMaglev(pool, key, int(cfg.TableSize))
+
 	default:
 		log.Printf("Error resolving balancer method. Defaulting to round-robin")
 		return NewRoundRobin(pool)
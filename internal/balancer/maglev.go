@@ -0,0 +1,206 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"proxymity/internal/backend"
+	"sync"
+	"time"
+)
+
+type maglevStats struct {
+	builds     int
+	lastBuild  time.Time
+	buildTime  time.Duration
+	backends   int
+	entries    map[string]int
+	disruption float64
+	imbalance  float64
+}
+
+type Maglev struct {
+	BaseLoadBalancer
+	key  KeyFunc
+	size int
+
+	mu         sync.RWMutex
+	table      []*backend.Backend
+	stats      maglevStats
+	generation uint64
+	built      bool
+}
+
+func NewMaglev(pool *backend.Pool, key KeyFunc, size int) *Maglev {
+	return &Maglev{
+		BaseLoadBalancer: BaseLoadBalancer{pool: pool},
+		key:              key,
+		size:             size,
+	}
+}
+
+// Looks the request key up in the Maglev table. The table only holds backends that were
+// available when it was built and is rebuilt as soon as the pool changes, so the walk to the
+// next slot only happens when a backend became unavailable between two rebuilds.
+func (m *Maglev) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := m.available(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := m.key(r)
+	if !ok {
+		return backends[rand.Intn(len(backends))], nil
+	}
+
+	available := make(map[*backend.Backend]bool, len(backends))
+	for _, b := range backends {
+		available[b] = true
+	}
+
+	table := m.getTable()
+	idx := int(hashKey(key) % uint64(len(table)))
+
+	for i := 0; i < len(table); i++ {
+		if b := table[(idx+i)%len(table)]; available[b] {
+			return b, nil
+		}
+	}
+
+	return backends[rand.Intn(len(backends))], nil
+}
+
+// Reports how the lookup table was last built: table size, build count and duration, the
+// share of slots owned by each backend, how uneven that share is (max/min slots) and the
+// fraction of slots that changed owner in the last rebuild
+func (m *Maglev) Stats() map[string]any {
+	m.getTable()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make(map[string]int, len(m.stats.entries))
+	for name, n := range m.stats.entries {
+		entries[name] = n
+	}
+
+	return map[string]any{
+		"method":        "maglev",
+		"table_size":    m.size,
+		"backends":      m.stats.backends,
+		"builds":        m.stats.builds,
+		"last_build":    m.stats.lastBuild.Unix(),
+		"build_time_ms": float64(m.stats.buildTime) / float64(time.Millisecond),
+		"entries":       entries,
+		"imbalance":     m.stats.imbalance,
+		"disruption":    m.stats.disruption,
+	}
+}
+
+// Returns the lookup table, rebuilding it first if the pool changed since the last build
+func (m *Maglev) getTable() []*backend.Backend {
+	gen := m.pool.Generation()
+
+	m.mu.RLock()
+	if m.built && m.generation == gen {
+		defer m.mu.RUnlock()
+		return m.table
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.built || m.generation != gen {
+		m.rebuild(gen)
+	}
+	return m.table
+}
+
+// Must be called with m.mu held
+func (m *Maglev) rebuild(gen uint64) {
+	start := time.Now()
+
+	backends, err := m.pool.GetAvailableBackends()
+	if err != nil {
+		// Keep the members on the table so lookups still resolve once some recover
+		backends = m.pool.GetBackends()
+	}
+
+	table := populateMaglev(backends, m.size)
+
+	entries := make(map[string]int, len(backends))
+	changed := 0
+	for i, b := range table {
+		if b != nil {
+			entries[b.Name]++
+		}
+		if m.table != nil && m.table[i] != b {
+			changed++
+		}
+	}
+
+	minEntries, maxEntries := 0, 0
+	for _, n := range entries {
+		if minEntries == 0 || n < minEntries {
+			minEntries = n
+		}
+		maxEntries = max(maxEntries, n)
+	}
+
+	m.stats.imbalance = 0
+	if minEntries > 0 {
+		m.stats.imbalance = float64(maxEntries) / float64(minEntries)
+	}
+	m.stats.disruption = 0
+	if m.table != nil {
+		m.stats.disruption = float64(changed) / float64(len(table))
+	}
+
+	m.table = table
+	m.stats.builds++
+	m.stats.lastBuild = start
+	m.stats.buildTime = time.Since(start)
+	m.stats.backends = len(backends)
+	m.stats.entries = entries
+	m.generation = gen
+	m.built = true
+}
+
+// Fills a table of the given (prime) size following the Maglev paper: every backend walks
+// its own permutation of the slots and claims the next free one, one turn per unit of
+// weight, until the table is full
+func populateMaglev(backends []*backend.Backend, size int) []*backend.Backend {
+	table := make([]*backend.Backend, size)
+	if len(backends) == 0 {
+		return table
+	}
+
+	offsets := make([]uint64, len(backends))
+	skips := make([]uint64, len(backends))
+	next := make([]uint64, len(backends))
+	for i, b := range backends {
+		offsets[i] = hashKey(b.Name) % uint64(size)
+		skips[i] = hashKey(b.Name+"#skip")%uint64(size-1) + 1
+	}
+
+	filled := 0
+	for {
+		for i, b := range backends {
+			for turn := 0; turn < max(b.GetWeight(), 1); turn++ {
+				c := (offsets[i] + next[i]*skips[i]) % uint64(size)
+				for table[c] != nil {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % uint64(size)
+				}
+
+				table[c] = b
+				next[i]++
+				filled++
+
+				if filled == size {
+					return table
+				}
+			}
+		}
+	}
+}
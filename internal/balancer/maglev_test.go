@@ -0,0 +1,88 @@
+package loadbalancer
+
+import (
+	"proxymity/internal/backend"
+	"testing"
+)
+
+func TestPopulateMaglev(t *testing.T) {
+	tests := []struct {
+		size    int
+		weights map[string]int
+	}{
+		{size: 7, weights: map[string]int{"a": 1, "b": 1}},
+		{size: 65537, weights: map[string]int{"a": 1, "b": 1, "c": 1}},
+		{size: 65537, weights: map[string]int{"a": 3, "b": 1}},
+		{size: 251, weights: map[string]int{"a": 1, "b": 2, "c": 1, "d": 1, "e": 1}},
+	}
+
+	for _, tt := range tests {
+		var (
+			backends    []*backend.Backend
+			totalWeight int
+		)
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			if w, ok := tt.weights[name]; ok {
+				b := &backend.Backend{Name: name}
+				b.SetWeight(w)
+				backends = append(backends, b)
+				totalWeight += w
+			}
+		}
+
+		table := populateMaglev(backends, tt.size)
+		if len(table) != tt.size {
+			t.Fatalf("weights %v: table has %d slots, want %d", tt.weights, len(table), tt.size)
+		}
+
+		// Every permutation claims a free slot per turn, so the table fills up completely and
+		// the shares follow the weights up to one turn
+		counts := make(map[string]int)
+		for i, b := range table {
+			if b == nil {
+				t.Fatalf("weights %v: slot %d of %d is empty", tt.weights, i, tt.size)
+			}
+			counts[b.Name]++
+		}
+
+		for name, w := range tt.weights {
+			want := float64(tt.size) * float64(w) / float64(totalWeight)
+			if got := float64(counts[name]); got < want-float64(totalWeight) || got > want+float64(totalWeight) {
+				t.Errorf("size %d, weights %v: %s owns %d slots, want %.0f", tt.size, tt.weights, name, counts[name], want)
+			}
+		}
+	}
+}
+
+func TestMaglevRebuild(t *testing.T) {
+	pool := newTestPool("a", "b", "c", "d", "e")
+	m := NewMaglev(pool, pathKey, 65537)
+
+	builds := func() int { return m.Stats()["builds"].(int) }
+
+	before := assignments(t, m, 2000)
+	assignments(t, m, 2000)
+	if got := builds(); got != 1 {
+		t.Fatalf("builds = %d after lookups on an unchanged pool, want 1", got)
+	}
+
+	// Losing one of five backends rebuilds the table and should move little more than its share
+	pool.GetBackend("c").SetAlive(false)
+	after := assignments(t, m, 2000)
+
+	if got := builds(); got != 2 {
+		t.Errorf("builds = %d after a pool change, want 2", got)
+	}
+	if got := m.Stats()["backends"].(int); got != 4 {
+		t.Errorf("table built from %d backends, want 4", got)
+	}
+	if d := m.Stats()["disruption"].(float64); d < 0.2 || d > 0.3 {
+		t.Errorf("disruption = %.3f, want between 0.2 and 0.3", d)
+	}
+
+	for i := range before {
+		if after[i] == "c" {
+			t.Fatalf("key %d still maps to the unavailable backend", i)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"proxymity/internal/backend"
+	"sync"
+)
+
+// Load signals understood by the power-of-two-choices balancer
+const (
+	LoadInFlight = "in-flight"
+	LoadLatency  = "latency"
+	LoadCombined = "combined"
+)
+
+// Scores a backend, lower means less loaded
+type LoadFunc func(b *backend.Backend) float64
+
+type P2C struct {
+	BaseLoadBalancer
+	load LoadFunc
+
+	mu         sync.RWMutex
+	backends   []*backend.Backend
+	err        error
+	generation uint64
+	built      bool
+}
+
+func NewP2C(pool *backend.Pool, signal string) *P2C {
+	return &P2C{
+		BaseLoadBalancer: BaseLoadBalancer{pool: pool},
+		load:             ResolveLoad(signal),
+	}
+}
+
+// Returns the scoring function for the given load signal, defaulting to in-flight requests
+func ResolveLoad(signal string) LoadFunc {
+	switch signal {
+	case LoadLatency:
+		return func(b *backend.Backend) float64 {
+			return float64(b.LatencyEWMA())
+		}
+
+	case LoadCombined:
+		return func(b *backend.Backend) float64 {
+			return b.Cost()
+		}
+
+	default:
+		return func(b *backend.Backend) float64 {
+			return float64(b.ActiveRequests())
+		}
+	}
+}
+
+// Samples two distinct backends at random and returns the less loaded one
+func (p *P2C) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := p.candidates()
+	if err != nil {
+		return nil, err
+	}
+	if backends, err = narrow(r, backends); err != nil {
+		return nil, err
+	}
+
+	if len(backends) == 1 {
+		return backends[0], nil
+	}
+
+	i := rand.Intn(len(backends))
+	j := rand.Intn(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := backends[i], backends[j]
+	if p.load(b) < p.load(a) {
+		return b, nil
+	}
+	return a, nil
+}
+
+func (p *P2C) CountAvailableBackends(r *http.Request) int {
+	backends, err := p.candidates()
+	if err != nil {
+		return 0
+	}
+	if backends, err = narrow(r, backends); err != nil {
+		return 0
+	}
+	return len(backends)
+}
+
+// Returns the available backends, listed again only when the pool changed since the last call
+func (p *P2C) candidates() ([]*backend.Backend, error) {
+	gen := p.pool.Generation()
+
+	p.mu.RLock()
+	if p.built && p.generation == gen {
+		defer p.mu.RUnlock()
+		return p.backends, p.err
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.built || p.generation != gen {
+		p.backends, p.err = p.pool.GetAvailableBackends()
+		p.generation = gen
+		p.built = true
+	}
+	return p.backends, p.err
+}
@@ -0,0 +1,43 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"proxymity/internal/backend"
+)
+
+type PeakEWMA struct {
+	BaseLoadBalancer
+}
+
+func NewPeakEWMA(pool *backend.Pool) *PeakEWMA {
+	return &PeakEWMA{
+		BaseLoadBalancer: BaseLoadBalancer{pool: pool},
+	}
+}
+
+// Returns the backend with the lowest latency times outstanding requests, picking randomly among ties
+func (pe *PeakEWMA) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := pe.available(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		candidates []*backend.Backend
+		minCost    float64
+	)
+	for _, b := range backends {
+		cost := b.Cost()
+
+		switch {
+		case candidates == nil, cost < minCost:
+			candidates = append(candidates[:0], b)
+			minCost = cost
+		case cost == minCost:
+			candidates = append(candidates, b)
+		}
+	}
+
+	return candidates[rand.Intn(len(candidates))], nil
+}
@@ -2,6 +2,7 @@ package loadbalancer
 
 import (
 	"math/rand"
+	"net/http"
 	"proxymity/internal/backend"
 )
 
@@ -15,8 +16,8 @@ func NewRandom(pool *backend.Pool) *Random {
 	}
 }
 
-func (r *Random) NextBackend() (*backend.Backend, error) {
-	backends, err := r.pool.GetAvailableBackends()
+func (rnd *Random) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := rnd.available(r)
 	if err != nil {
 		return nil, err
 	}
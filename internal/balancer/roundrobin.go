@@ -1,6 +1,8 @@
 package loadbalancer
 
 import (
+	"math/rand"
+	"net/http"
 	"proxymity/internal/backend"
 	"sync/atomic"
 )
@@ -16,13 +18,22 @@ func NewRoundRobin(pool *backend.Pool) *RoundRobin {
 	}
 }
 
-func (rr *RoundRobin) NextBackend() (*backend.Backend, error) {
-	backends, err := rr.pool.GetAvailableBackends()
+func (rr *RoundRobin) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := rr.available(r)
 	if err != nil {
 		return nil, err
 	}
 
 	next := atomic.AddUint64(&rr.current, 1)
 	idx := int(next-1) % len(backends)
-	return backends[idx], err
+
+	// A backend still in slow start only takes its turn with a probability equal to its ramp,
+	// otherwise the turn passes to the next one in line
+	for i := 0; i < len(backends); i++ {
+		b := backends[(idx+i)%len(backends)]
+		if ramp := b.RampFactor(); ramp >= 1 || rand.Float64() < ramp {
+			return b, nil
+		}
+	}
+	return backends[idx], nil
 }
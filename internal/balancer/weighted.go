@@ -1,55 +1,61 @@
 package loadbalancer
 
 import (
-	"crypto/rand"
-	"fmt"
-	"math/big"
+	"math"
+	"net/http"
 	"proxymity/internal/backend"
+	"sync"
 )
 
+// Effective weights are fractional during slow start, so they are scaled up to integers
+const weightScale = 100
+
+// Smooth weighted round-robin as implemented by nginx. With weights {a:5, b:1, c:1} it yields
+// a a b a c a a rather than a a a a a b c.
 type Weighted struct {
 	BaseLoadBalancer
+
+	mu         sync.Mutex
+	current    map[*backend.Backend]int
+	generation uint64
 }
 
 func NewWeighted(pool *backend.Pool) *Weighted {
 	return &Weighted{
 		BaseLoadBalancer: BaseLoadBalancer{pool: pool},
+		current:          make(map[*backend.Backend]int),
 	}
 }
 
-func (rr *Weighted) NextBackend() (*backend.Backend, error) {
-	backends, err := rr.pool.GetAvailableBackends()
+func (w *Weighted) NextBackend(r *http.Request) (*backend.Backend, error) {
+	backends, err := w.available(r)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate total weight
-	total := 0
-	for _, b := range backends {
-		total += b.GetWeight()
-	}
-	if total <= 0 {
-		return nil, fmt.Errorf("total weight is zero")
-	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	max := big.NewInt(int64(total))
-	nBig, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		return nil, fmt.Errorf("error generating random weight coefficient: %w", err)
+	// Start over from a clean state whenever backends are added, removed or change health
+	if gen := w.pool.Generation(); gen != w.generation {
+		w.current = make(map[*backend.Backend]int, len(backends))
+		w.generation = gen
 	}
-	coeff := int(nBig.Int64()) + 1
 
+	var (
+		best  *backend.Backend
+		total int
+	)
 	for _, b := range backends {
-		coeff -= b.GetWeight()
-		if coeff <= 0 {
-			return b, nil
-		}
-	}
+		weight := int(math.Ceil(b.EffectiveWeight() * weightScale))
+		w.current[b] += weight
+		total += weight
 
-	// Fallback: return last backend if any
-	if len(backends) > 0 {
-		return backends[len(backends)-1], nil
+		if best == nil || w.current[b] > w.current[best] {
+			best = b
+		}
 	}
 
-	return nil, fmt.Errorf("no backend selected")
+	w.current[best] -= total
+	return best, nil
 }
@@ -0,0 +1,66 @@
+package loadbalancer
+
+import (
+	"net/http/httptest"
+	"proxymity/internal/backend"
+	"proxymity/internal/metrics"
+	"strings"
+	"testing"
+)
+
+func TestWeightedOrder(t *testing.T) {
+	tests := []struct {
+		weights map[string]int
+		order   []string
+		want    string
+	}{
+		{weights: map[string]int{"a": 5, "b": 1, "c": 1}, order: []string{"a", "b", "c"}, want: "aabacaa"},
+		{weights: map[string]int{"a": 1, "b": 1, "c": 1}, order: []string{"a", "b", "c"}, want: "abcabc"},
+		{weights: map[string]int{"a": 2, "b": 1}, order: []string{"a", "b"}, want: "abaaba"},
+	}
+
+	for _, tt := range tests {
+		pool := backend.NewPool(metrics.NewMetrics())
+		for _, name := range tt.order {
+			addTestBackend(pool, name, tt.weights[name])
+		}
+		w := NewWeighted(pool)
+
+		var got strings.Builder
+		for range len(tt.want) {
+			b, err := w.NextBackend(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.WriteString(b.Name)
+		}
+
+		if got.String() != tt.want {
+			t.Errorf("weights %v: order = %s, want %s", tt.weights, got.String(), tt.want)
+		}
+	}
+}
+
+func TestWeightedResetsOnPoolChange(t *testing.T) {
+	pool := newTestPool("a", "b")
+	pool.GetBackend("a").SetWeight(3)
+	w := NewWeighted(pool)
+
+	next := func() string {
+		b, err := w.NextBackend(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Name
+	}
+
+	next()
+	next()
+
+	// A health flip starts the sequence over, so the heaviest backend leads again
+	pool.GetBackend("b").SetAlive(false)
+	pool.GetBackend("b").SetAlive(true)
+	if got := next(); got != "a" {
+		t.Errorf("first pick after a pool change = %s, want a", got)
+	}
+}
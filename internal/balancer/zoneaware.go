@@ -0,0 +1,129 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"net/http"
+	"proxymity/internal/backend"
+	"sync/atomic"
+)
+
+// ZoneAware keeps traffic inside the proxy's own zone while that zone is healthy and not
+// overloaded, and otherwise spills a proportional share of requests to the other zones.
+// The actual pick is delegated to the wrapped balancer.
+type ZoneAware struct {
+	next       LoadBalancer
+	pool       *backend.Pool
+	zone       string
+	minHealthy float64
+	overload   float64
+
+	// Requests of this upstream served in and out of zone
+	localZone int64
+	crossZone int64
+}
+
+func NewZoneAware(next LoadBalancer, pool *backend.Pool, zone string, minHealthy, overload float64) *ZoneAware {
+	return &ZoneAware{
+		next:       next,
+		pool:       pool,
+		zone:       zone,
+		minHealthy: minHealthy,
+		overload:   overload,
+	}
+}
+
+func (z *ZoneAware) NextBackend(r *http.Request) (*backend.Backend, error) {
+	spill := z.spillFraction()
+
+	local := rand.Float64() >= spill
+	zoned := WithFilter(r, func(b *backend.Backend) bool {
+		return (b.Zone == z.zone) == local
+	})
+
+	b, err := z.next.NextBackend(zoned)
+	if err != nil {
+		// The preferred side has nothing to offer, let the wrapped balancer pick from every zone
+		b, err = z.next.NextBackend(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Zone == z.zone {
+		atomic.AddInt64(&z.localZone, 1)
+	} else {
+		atomic.AddInt64(&z.crossZone, 1)
+	}
+	return b, nil
+}
+
+// Every zone counts, since a pick falls back to all zones when the preferred side has none
+func (z *ZoneAware) CountAvailableBackends(r *http.Request) int {
+	return z.next.CountAvailableBackends(r)
+}
+
+// Returns the share of requests that should leave the local zone. It is the unhealthy share
+// of the local zone once its healthy fraction drops below minHealthy, or the share of local
+// load in excess of overload times the remote average when the local zone is busier.
+func (z *ZoneAware) spillFraction() float64 {
+	available, err := z.pool.GetAvailableBackends()
+	if err != nil {
+		return 0
+	}
+
+	var (
+		localTotal, localUp   int
+		localLoad, remoteLoad int64
+		remoteUp              int
+	)
+	for _, b := range z.pool.GetBackends() {
+		if b.Zone == z.zone && b.IsEnabled() {
+			localTotal++
+		}
+	}
+	for _, b := range available {
+		if b.Zone == z.zone {
+			localUp++
+			localLoad += b.ActiveRequests()
+		} else {
+			remoteUp++
+			remoteLoad += b.ActiveRequests()
+		}
+	}
+
+	switch {
+	case remoteUp == 0:
+		return 0
+	case localUp == 0:
+		return 1
+	}
+
+	spill := 0.0
+	if healthy := float64(localUp) / float64(localTotal); healthy < z.minHealthy {
+		spill = 1 - healthy
+	}
+
+	localAvg := float64(localLoad) / float64(localUp)
+	remoteAvg := float64(remoteLoad) / float64(remoteUp)
+	if limit := remoteAvg * z.overload; localAvg > limit && localAvg > 0 {
+		spill = max(spill, 1-limit/localAvg)
+	}
+
+	return spill
+}
+
+// Reports the local zone, the current spill fraction and the requests routed in and out of
+// zone, along with the wrapped balancer's own stats
+func (z *ZoneAware) Stats() map[string]any {
+	stats := map[string]any{
+		"zone":                z.zone,
+		"spill_fraction":      z.spillFraction(),
+		"local_zone_requests": atomic.LoadInt64(&z.localZone),
+		"cross_zone_requests": atomic.LoadInt64(&z.crossZone),
+	}
+
+	if r, ok := z.next.(StatsReporter); ok {
+		stats["balancer"] = r.Stats()
+	}
+	return stats
+}
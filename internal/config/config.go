@@ -3,33 +3,251 @@ package config
 import "proxymity/internal/metrics"
 
 type Config struct {
-	Proxy        ProxyConfig        `yaml:"proxy"`
-	Backed       []BackendConfig    `yaml:"backend"`
-	LoadBalancer LoadBalancerConfig `yaml:"load-balancer"`
-	HealthCheck  HealthCheckConfig  `yaml:"health-check"`
+	Proxy        ProxyConfig          `yaml:"proxy"`
+	Backed       []BackendConfig      `yaml:"backend"`
+	LoadBalancer LoadBalancerConfig   `yaml:"load-balancer"`
+	HealthCheck  HealthCheckConfig    `yaml:"health-check"`
+	Retry        RetryConfig          `yaml:"retry"`
+	Breaker      CircuitBreakerConfig `yaml:"circuit-breaker"`
+	Outlier      OutlierConfig        `yaml:"outlier-detection"`
+	Sticky       StickySessionConfig  `yaml:"sticky-session"`
+	Upstreams    []UpstreamConfig     `yaml:"upstreams"`
+	Routes       []RouteConfig        `yaml:"routes"`
+	VirtualHosts VirtualHostsConfig   `yaml:"virtual-hosts"`
+	Headers      HeaderRulesConfig    `yaml:"headers"` // Applied to every request and response
+	AccessLog    AccessLogConfig      `yaml:"access-log"`
 
 	m *metrics.Metrics
 }
 
 type ProxyConfig struct {
-	Host      string `yaml:"host"`
-	Port      string `yaml:"port"`
-	AdminPort string `yaml:"admin_port"`
+	Host           string   `yaml:"host"`
+	Port           string   `yaml:"port"`
+	AdminPort      string   `yaml:"admin_port"`
+	Zone           string   `yaml:"zone"`            // Zone the proxy runs in, enables zone-aware routing
+	TrustedProxies []string `yaml:"trusted_proxies"` // CIDRs whose forwarding headers are trusted
 }
 
 type BackendConfig struct {
-	Name    string `yaml:"name"`
-	Host    string `yaml:"url"`
-	Health  string `yaml:"health"`
-	Weight  int    `yaml:"weight"`
-	Enabled bool   `yaml:"enabled"`
+	Name     string            `yaml:"name"`
+	Host     string            `yaml:"url"`
+	Health   string            `yaml:"health"`
+	Weight   int               `yaml:"weight"`
+	Enabled  *bool             `yaml:"enabled"`  // Defaults to true, disabled backends receive no traffic
+	Priority int               `yaml:"priority"` // Failover tier, 0 is the primary one
+	Backup   bool              `yaml:"backup"`   // Shorthand for priority 1 when no priority is set
+	Zone     string            `yaml:"zone"`     // Locality label matched against the proxy zone
+	Headers  HeaderRulesConfig `yaml:"headers"`  // Applied after the global and route rules
+	Check    HealthProbeConfig `yaml:"health-check"`
+}
+
+// How the active health checker probes a backend and how many results flip its state. The
+// method, headers, host, statuses and body fields only apply to http probes, port applies to
+// every type but exec.
+type HealthProbeConfig struct {
+	Type               string            `yaml:"type"`                // http, tcp, tls, grpc or exec
+	Interval           uint              `yaml:"interval"`            // Seconds between probes, overrides the group interval
+	TimeOut            uint              `yaml:"timeout"`             // Probe timeout in seconds, overrides the group timeout
+	HealthyThreshold   uint              `yaml:"healthy-threshold"`   // Passing probes in a row that mark the backend healthy
+	UnhealthyThreshold uint              `yaml:"unhealthy-threshold"` // Failing probes in a row that mark the backend unhealthy
+	Statuses           []string          `yaml:"statuses"`            // Accepted codes: "204", "2xx" or "200-399"
+	Method             string            `yaml:"method"`
+	Headers            map[string]string `yaml:"headers" json:"-"`     // Often carry credentials, never exposed by the config endpoint
+	Host               string            `yaml:"host"`                 // Host header sent with the probe, defaults to the backend host
+	Port               string            `yaml:"port"`                 // Probe this port instead of the backend one
+	Body               string            `yaml:"body"`                 // Substring the response body must contain
+	BodyRegex          string            `yaml:"body-regex"`           // Regular expression the response body must match
+	JSONPath           string            `yaml:"json-path"`            // Dotted path into a JSON body, e.g. "checks.db.status" or "items.0.ok"
+	JSONValue          string            `yaml:"json-value"`           // Expected value at JSONPath, empty only requires a non-null value
+	ServerName         string            `yaml:"server-name"`          // tls: name verified against the certificate, defaults to the backend host
+	InsecureSkipVerify bool              `yaml:"insecure-skip-verify"` // tls and grpc over https: accept any certificate
+	Service            string            `yaml:"service"`              // grpc: service name sent in the check, empty asks about the whole server
+	Command            []string          `yaml:"command"`              // exec: program and arguments, exit code 0 means healthy
 }
 
 type LoadBalancerConfig struct {
-	Method string `yaml:"method"`
+	Method       string          `yaml:"method"`
+	LoadSignal   string          `yaml:"load-signal"`        // Load measure used by p2c: in-flight, latency or combined
+	Decay        uint            `yaml:"decay"`              // Time constant of the latency moving average in seconds
+	HashKey      string          `yaml:"hash-key"`           // Request attribute hashed by consistent-hash: client-ip, path, header:<name>, cookie:<name> or query:<name>
+	VirtualNodes uint            `yaml:"virtual-nodes"`      // Ring points per unit of backend weight for consistent-hash
+	TableSize    uint            `yaml:"table-size"`         // Lookup table size for maglev, must be prime
+	Failover     *float64        `yaml:"failover-threshold"` // Healthy fraction below which a priority tier spills onto the next, 0 only spills once a tier is down
+	SlowStart    uint            `yaml:"slow-start"`         // Seconds a recovered or new backend takes to ramp up to its full weight, 0 disables
+	ZoneAware    ZoneAwareConfig `yaml:"zone-aware"`
+}
+
+type ZoneAwareConfig struct {
+	MinHealthy *float64 `yaml:"min-healthy"`     // Healthy fraction of the local zone below which requests spill to other zones, 0 never spills for health
+	Overload   float64  `yaml:"overload-factor"` // Local load, relative to the remote average, above which requests spill
 }
 
 type HealthCheckConfig struct {
-	Interval uint // Interval between checks in seconds
-	TimeOut  uint // Health check timeout in seconds
+	Interval    uint     `yaml:"interval"`    // Interval between checks in seconds
+	TimeOut     uint     `yaml:"timeout"`     // Health check timeout in seconds
+	Jitter      *float64 `yaml:"jitter"`      // Fraction of the interval each check is randomly moved by, 0.1 is +/-10%, 0 disables
+	Concurrency uint     `yaml:"concurrency"` // Probes in flight at once across the group
+}
+
+// Requests are only retried when their method is idempotent or listed in Methods, their body
+// fits in MaxBodySize and no response byte reached the client yet
+type RetryConfig struct {
+	Attempts    uint               `yaml:"attempts"`      // Tries per request including the first one, 1 disables retries
+	MaxBodySize uint               `yaml:"max-body-size"` // Largest request body in bytes buffered for replay
+	Methods     []string           `yaml:"methods"`       // Non-idempotent methods that may be retried anyway, e.g. POST
+	Statuses    []int              `yaml:"statuses"`      // Backend response codes retried on another backend
+	Budget      RetryBudgetConfig  `yaml:"budget"`
+	Backoff     RetryBackoffConfig `yaml:"backoff"`
+}
+
+// Caps retries to a share of the requests seen over a sliding window, so retries cannot
+// multiply the load on backends that are already failing
+type RetryBudgetConfig struct {
+	Ratio        *float64 `yaml:"ratio"`          // Retries allowed per request over the window, 0.2 allows 20%, 0 only allows MinPerSecond
+	MinPerSecond *uint    `yaml:"min-per-second"` // Retries always allowed per second, so low traffic can still retry
+	Window       uint     `yaml:"window"`         // Length of the sliding window in seconds
+}
+
+// Exponential backoff with full jitter: retry n waits a random time up to min(max, base * 2^(n-1))
+type RetryBackoffConfig struct {
+	Base uint `yaml:"base"` // Milliseconds
+	Max  uint `yaml:"max"`  // Milliseconds
+}
+
+// Per-backend circuit breaker. Connection errors and 5xx responses count as failures.
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures *uint   `yaml:"consecutive-failures"` // Failures in a row that open the circuit, 0 only uses the failure ratio
+	FailureRatio        float64 `yaml:"failure-ratio"`        // Failed share of the window's requests that opens the circuit
+	MinRequests         uint    `yaml:"min-requests"`         // Requests the window needs before the failure ratio applies
+	Window              uint    `yaml:"window"`               // Rolling window in seconds
+	OpenDuration        uint    `yaml:"open-duration"`        // Seconds the circuit stays open before probing the backend
+	HalfOpenRequests    uint    `yaml:"half-open-requests"`   // Concurrent probes while half-open, all must succeed to close
+}
+
+// Passive health checking: backends are ejected from rotation based on the live traffic they serve
+type OutlierConfig struct {
+	Enabled            bool    `yaml:"enabled"`
+	Interval           uint    `yaml:"interval"`                   // Seconds between success rate and latency analyses
+	Consecutive5xx     uint    `yaml:"consecutive-5xx"`            // 5xx responses in a row that eject a backend
+	ConsecutiveGateway uint    `yaml:"consecutive-gateway-errors"` // Connection errors, 502, 503 or 504 in a row that eject a backend
+	SuccessRateStdev   float64 `yaml:"success-rate-stdev-factor"`  // Ejects success rates below mean - factor * stdev of the pool
+	LatencyFactor      float64 `yaml:"latency-factor"`             // Ejects average latencies above factor * the median of the pool
+	MinHosts           uint    `yaml:"min-hosts"`                  // Backends with enough requests needed to compare them
+	MinRequests        uint    `yaml:"min-requests"`               // Requests per interval a backend needs to be compared
+	BaseEjection       uint    `yaml:"base-ejection-time"`         // Seconds, multiplied by the number of ejections in a row
+	MaxEjection        uint    `yaml:"max-ejection-time"`          // Seconds an ejection lasts at most
+	MaxEjectionPercent uint    `yaml:"max-ejection-percent"`       // Share of the backends that may be ejected at once, at least one always may
+}
+
+type StickySessionConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Cookie   string `yaml:"cookie"`       // Name of the cookie issued by the proxy
+	TTL      uint   `yaml:"ttl"`          // Idle seconds before a session expires
+	Path     string `yaml:"path"`         // Cookie path
+	SameSite string `yaml:"same-site"`    // lax, strict or none
+	Secure   bool   `yaml:"secure"`       // Only send the cookie over HTTPS
+	Key      string `yaml:"key" json:"-"` // HMAC key used to sign the cookie, never exposed by the config endpoint
+}
+
+// A named group of backends with its own balancing and health checking
+type UpstreamConfig struct {
+	Name         string               `yaml:"name"`
+	Backends     []BackendConfig      `yaml:"backend"`
+	LoadBalancer LoadBalancerConfig   `yaml:"load-balancer"`
+	HealthCheck  HealthCheckConfig    `yaml:"health-check"`
+	Retry        RetryConfig          `yaml:"retry"`
+	Breaker      CircuitBreakerConfig `yaml:"circuit-breaker"`
+	Outlier      OutlierConfig        `yaml:"outlier-detection"`
+}
+
+// Sends the requests matching every condition of Match to the named upstream
+type RouteConfig struct {
+	Name     string            `yaml:"name"`
+	Match    RouteMatch        `yaml:"match"`
+	Upstream string            `yaml:"upstream"`
+	Rewrite  RewriteConfig     `yaml:"rewrite"`
+	Headers  HeaderRulesConfig `yaml:"headers"` // Applied after the global rules
+}
+
+type RouteMatch struct {
+	Host       string            `yaml:"host"`        // Host header without port
+	PathPrefix string            `yaml:"path-prefix"` // Leading part of the request path
+	Methods    []string          `yaml:"methods"`     // Any of these HTTP methods
+	Headers    map[string]string `yaml:"headers"`     // Exact header values, empty only requires presence
+}
+
+// Path rewriting applied before forwarding, in order: strip-prefix, regex, add-prefix
+type RewriteConfig struct {
+	StripPrefix       string `yaml:"strip-prefix"`        // Removed from the start of the path
+	AddPrefix         string `yaml:"add-prefix"`          // Prepended to the path
+	Regex             string `yaml:"regex"`               // Applied to the path, replaced by Replacement
+	Replacement       string `yaml:"replacement"`         // May reference capture groups as $1 or ${name}
+	RewriteLocation   bool   `yaml:"rewrite-location"`    // Map Location headers back onto the public layout
+	RewriteCookiePath bool   `yaml:"rewrite-cookie-path"` // Map Set-Cookie paths back onto the public layout
+}
+
+// Header operations for requests before forwarding and responses before returning
+type HeaderRulesConfig struct {
+	Request  HeaderOpsConfig `yaml:"request"`
+	Response HeaderOpsConfig `yaml:"response"`
+}
+
+// Operations run in this order: remove, rename, set, append. Set and append values may use
+// ${client_ip}, ${backend_name}, ${request_id}, ${host}, ${method}, ${path} and ${scheme}.
+type HeaderOpsConfig struct {
+	Set    map[string]string `yaml:"set"`    // Replace the header value
+	Append map[string]string `yaml:"append"` // Add a value, keeping existing ones
+	Remove []string          `yaml:"remove"` // Header names, a trailing * removes every header with that prefix
+	Rename map[string]string `yaml:"rename"` // Old name to new name
+}
+
+type AccessLogConfig struct {
+	Format string                `yaml:"format"` // json or logfmt
+	Fields []string              `yaml:"fields"` // Fields to log, in order. Empty logs every field
+	Sinks  []AccessLogSinkConfig `yaml:"sinks"`
+}
+
+type AccessLogSinkConfig struct {
+	Type       string `yaml:"type"`        // stdout, file or syslog
+	Path       string `yaml:"path"`        // file: log file path
+	MaxSize    uint   `yaml:"max-size"`    // file: megabytes before rotating, 0 never rotates
+	MaxAge     uint   `yaml:"max-age"`     // file: days rotated files are kept, 0 keeps them forever
+	MaxBackups int    `yaml:"max-backups"` // file: rotated files kept, 0 keeps them all
+	Network    string `yaml:"network"`     // syslog: udp, tcp or unix, empty for the local daemon
+	Address    string `yaml:"address"`     // syslog: daemon address or socket path
+	Tag        string `yaml:"tag"`         // syslog: message tag
+}
+
+type VirtualHostsConfig struct {
+	Default       string              `yaml:"default"`        // Vhost serving unknown hosts, if empty they are rejected
+	UnknownStatus int                 `yaml:"unknown-status"` // Status returned for unknown hosts, 421 or 404
+	Hosts         []VirtualHostConfig `yaml:"hosts"`
+}
+
+// Sends the requests whose Host header matches one of Hosts to the named upstream. Hosts
+// are exact names, "*.example.com" wildcards or regular expressions prefixed with "~".
+type VirtualHostConfig struct {
+	Name     string   `yaml:"name"`
+	Hosts    []string `yaml:"match"`
+	Upstream string   `yaml:"upstream"`
+}
+
+// Returns every upstream group, including the default one made of the top-level backend,
+// load-balancer and health-check sections when backends are listed there
+func (c *Config) AllUpstreams() []UpstreamConfig {
+	upstreams := make([]UpstreamConfig, 0, len(c.Upstreams)+1)
+
+	if len(c.Backed) > 0 {
+		upstreams = append(upstreams, UpstreamConfig{
+			Name:         DefaultUpstreamName,
+			Backends:     c.Backed,
+			LoadBalancer: c.LoadBalancer,
+			HealthCheck:  c.HealthCheck,
+			Retry:        c.Retry,
+			Breaker:      c.Breaker,
+			Outlier:      c.Outlier,
+		})
+	}
+
+	return append(upstreams, c.Upstreams...)
 }
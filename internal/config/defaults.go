@@ -1,30 +1,110 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
 
 // Default values
 const (
+	DefaultUpstreamName       = "default"
 	DefaultProxyHost          = "0.0.0.0"
 	DefaultProxyPort          = "8080"
 	DefaultAdminPort          = "9090"
 	DefaultLoadBalancerMethod = "round-robin"
+	DefaultLoadSignal         = "in-flight"
+	DefaultLatencyDecay       = 10 // seconds
+	DefaultHashKey            = "client-ip"
+	DefaultVirtualNodes       = 160
+	DefaultMaglevTableSize    = 65537
+	DefaultFailoverThreshold  = 0.5
+	DefaultZoneMinHealthy     = 0.7
+	DefaultZoneOverload       = 1.5
 	DefaultHealthCheckPath    = "/health"
 	DefaultBackendWeight      = 1
 	DefaultHealthInterval     = 30 // seconds
 	DefaultHealthTimeout      = 5  // seconds
+	DefaultHealthJitter       = 0.1
+	DefaultHealthConcurrency  = 16
+	DefaultHealthyThreshold   = 2
+	DefaultUnhealthyThreshold = 3
+	DefaultHealthStatuses     = "2xx"
+	DefaultHealthCheckType    = "http"
+	DefaultUnknownHostStatus  = 421
+	DefaultRetryAttempts      = 3
+	DefaultRetryMaxBodySize   = 64 << 10 // bytes
+	DefaultRetryBudgetRatio   = 0.2
+	DefaultRetryMinPerSecond  = 10
+	DefaultRetryBudgetWindow  = 10  // seconds
+	DefaultRetryBackoffBase   = 25  // milliseconds
+	DefaultRetryBackoffMax    = 250 // milliseconds
+	DefaultBreakerFailures    = 5
+	DefaultBreakerRatio       = 0.5
+	DefaultBreakerMinRequests = 20
+	DefaultBreakerWindow      = 10 // seconds
+	DefaultBreakerOpen        = 10 // seconds
+	DefaultBreakerHalfOpen    = 3
+	DefaultOutlierInterval    = 10 // seconds
+	DefaultOutlierConsecutive = 5
+	DefaultOutlierStdevFactor = 1.9
+	DefaultOutlierLatency     = 3
+	DefaultOutlierMinHosts    = 5
+	DefaultOutlierMinRequests = 100
+	DefaultOutlierBaseEject   = 30  // seconds
+	DefaultOutlierMaxEject    = 300 // seconds
+	DefaultOutlierMaxPercent  = 10
+	DefaultAccessLogFormat    = "json"
+	DefaultAccessLogMaxSize   = 100 // megabytes
+	DefaultSyslogTag          = "proxymity"
+	DefaultStickyCookie       = "proxymity_backend"
+	DefaultStickyTTL          = 3600 // seconds
+	DefaultStickyPath         = "/"
+	DefaultStickySameSite     = "lax"
 )
 
 // Applies default values to backend configurations and returns a slice of warning messages for any defaults that were applied
 func ApplyBackendDefaults(backends []BackendConfig) []string {
 	warnings := []string{}
 
-	for _, b := range backends {
+	for i := range backends {
+		b := &backends[i]
 
 		if b.Health == "" {
 			b.Health = DefaultHealthCheckPath
 			warnings = append(warnings, fmt.Sprintf("Backend '%s': health check path not specified, using default: %s", b.Name, DefaultHealthCheckPath))
 		}
 
+		if b.Check.Type == "" {
+			b.Check.Type = DefaultHealthCheckType
+		}
+
+		if b.Check.HealthyThreshold == 0 {
+			b.Check.HealthyThreshold = DefaultHealthyThreshold
+		}
+
+		if b.Check.UnhealthyThreshold == 0 {
+			b.Check.UnhealthyThreshold = DefaultUnhealthyThreshold
+		}
+
+		if len(b.Check.Statuses) == 0 {
+			b.Check.Statuses = []string{DefaultHealthStatuses}
+		}
+
+		if b.Check.Method == "" {
+			b.Check.Method = http.MethodGet
+		}
+		b.Check.Method = strings.ToUpper(b.Check.Method)
+
+		if b.Enabled == nil {
+			enabled := true
+			b.Enabled = &enabled
+		}
+
+		if b.Backup && b.Priority == 0 {
+			b.Priority = 1
+		}
+
 		if b.Weight <= 0 {
 			oldWeight := b.Weight
 			b.Weight = DefaultBackendWeight
@@ -47,6 +127,10 @@ func ApplyLoadBalancerDefaults(lb *LoadBalancerConfig) []string {
 		"least-connections": true,
 		"weighted":          true,
 		"random":            true,
+		"p2c":               true,
+		"peak-ewma":         true,
+		"consistent-hash":   true,
+		"maglev":            true,
 	}
 
 	if lb.Method == "" {
@@ -58,6 +142,42 @@ func ApplyLoadBalancerDefaults(lb *LoadBalancerConfig) []string {
 		warnings = append(warnings, fmt.Sprintf("Invalid load balancer method '%s', using default: %s", oldMethod, DefaultLoadBalancerMethod))
 	}
 
+	if lb.Decay == 0 {
+		lb.Decay = DefaultLatencyDecay
+	}
+
+	if (lb.Method == "consistent-hash" || lb.Method == "maglev") && lb.HashKey == "" {
+		lb.HashKey = DefaultHashKey
+		warnings = append(warnings, fmt.Sprintf("Hash key not specified for %s, using default: %s", lb.Method, DefaultHashKey))
+	}
+
+	if lb.VirtualNodes == 0 {
+		lb.VirtualNodes = DefaultVirtualNodes
+	}
+
+	if lb.TableSize == 0 {
+		lb.TableSize = DefaultMaglevTableSize
+	}
+
+	if lb.Failover == nil {
+		failover := DefaultFailoverThreshold
+		lb.Failover = &failover
+	}
+
+	if lb.ZoneAware.MinHealthy == nil {
+		minHealthy := DefaultZoneMinHealthy
+		lb.ZoneAware.MinHealthy = &minHealthy
+	}
+
+	if lb.ZoneAware.Overload == 0 {
+		lb.ZoneAware.Overload = DefaultZoneOverload
+	}
+
+	if lb.Method == "p2c" && lb.LoadSignal == "" {
+		lb.LoadSignal = DefaultLoadSignal
+		warnings = append(warnings, fmt.Sprintf("Load signal not specified for p2c, using default: %s", DefaultLoadSignal))
+	}
+
 	return warnings
 }
 
@@ -75,6 +195,15 @@ func ApplyHealthCheckDefaults(hc *HealthCheckConfig) []string {
 		warnings = append(warnings, fmt.Sprintf("Health check timeout not specified, using default: %d seconds", DefaultHealthTimeout))
 	}
 
+	if hc.Jitter == nil {
+		jitter := DefaultHealthJitter
+		hc.Jitter = &jitter
+	}
+
+	if hc.Concurrency == 0 {
+		hc.Concurrency = DefaultHealthConcurrency
+	}
+
 	if hc.TimeOut >= hc.Interval {
 		warnings = append(warnings, fmt.Sprintf("Warning: Health check timeout (%d) should be less than interval (%d)", hc.TimeOut, hc.Interval))
 	}
@@ -82,22 +211,229 @@ func ApplyHealthCheckDefaults(hc *HealthCheckConfig) []string {
 	return warnings
 }
 
+// Applies default values to retry configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyRetryDefaults(r *RetryConfig) []string {
+	warnings := []string{}
+
+	if r.Attempts == 0 {
+		r.Attempts = DefaultRetryAttempts
+	}
+
+	if r.MaxBodySize == 0 {
+		r.MaxBodySize = DefaultRetryMaxBodySize
+	}
+
+	if r.Statuses == nil {
+		r.Statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+
+	for i, m := range r.Methods {
+		r.Methods[i] = strings.ToUpper(m)
+	}
+
+	if r.Budget.Ratio == nil {
+		ratio := DefaultRetryBudgetRatio
+		r.Budget.Ratio = &ratio
+	}
+
+	if r.Budget.MinPerSecond == nil {
+		minPerSecond := uint(DefaultRetryMinPerSecond)
+		r.Budget.MinPerSecond = &minPerSecond
+	}
+
+	if r.Budget.Window == 0 {
+		r.Budget.Window = DefaultRetryBudgetWindow
+	}
+
+	if r.Backoff.Base == 0 {
+		r.Backoff.Base = DefaultRetryBackoffBase
+	}
+
+	if r.Backoff.Max == 0 {
+		r.Backoff.Max = DefaultRetryBackoffMax
+	}
+
+	if r.Backoff.Max < r.Backoff.Base {
+		warnings = append(warnings, fmt.Sprintf("Retry backoff max (%d ms) is lower than its base (%d ms), using the base", r.Backoff.Max, r.Backoff.Base))
+		r.Backoff.Max = r.Backoff.Base
+	}
+
+	return warnings
+}
+
+// Applies default values to circuit breaker configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyCircuitBreakerDefaults(cb *CircuitBreakerConfig) []string {
+	warnings := []string{}
+
+	if cb.ConsecutiveFailures == nil {
+		failures := uint(DefaultBreakerFailures)
+		cb.ConsecutiveFailures = &failures
+	}
+
+	if cb.FailureRatio == 0 {
+		cb.FailureRatio = DefaultBreakerRatio
+	}
+
+	if cb.MinRequests == 0 {
+		cb.MinRequests = DefaultBreakerMinRequests
+	}
+
+	if cb.Window == 0 {
+		cb.Window = DefaultBreakerWindow
+	}
+
+	if cb.OpenDuration == 0 {
+		cb.OpenDuration = DefaultBreakerOpen
+	}
+
+	if cb.HalfOpenRequests == 0 {
+		cb.HalfOpenRequests = DefaultBreakerHalfOpen
+	}
+
+	return warnings
+}
+
+// Applies default values to outlier detection configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyOutlierDefaults(o *OutlierConfig) []string {
+	warnings := []string{}
+
+	if !o.Enabled {
+		return warnings
+	}
+
+	if o.Interval == 0 {
+		o.Interval = DefaultOutlierInterval
+	}
+
+	if o.Consecutive5xx == 0 {
+		o.Consecutive5xx = DefaultOutlierConsecutive
+	}
+
+	if o.ConsecutiveGateway == 0 {
+		o.ConsecutiveGateway = DefaultOutlierConsecutive
+	}
+
+	if o.SuccessRateStdev == 0 {
+		o.SuccessRateStdev = DefaultOutlierStdevFactor
+	}
+
+	if o.LatencyFactor == 0 {
+		o.LatencyFactor = DefaultOutlierLatency
+	}
+
+	if o.MinHosts == 0 {
+		o.MinHosts = DefaultOutlierMinHosts
+	}
+
+	if o.MinRequests == 0 {
+		o.MinRequests = DefaultOutlierMinRequests
+	}
+
+	if o.BaseEjection == 0 {
+		o.BaseEjection = DefaultOutlierBaseEject
+	}
+
+	if o.MaxEjection == 0 {
+		o.MaxEjection = DefaultOutlierMaxEject
+	}
+
+	if o.MaxEjectionPercent == 0 {
+		o.MaxEjectionPercent = DefaultOutlierMaxPercent
+	}
+
+	if o.MaxEjection < o.BaseEjection {
+		warnings = append(warnings, fmt.Sprintf("Outlier max ejection time (%d s) is lower than the base one (%d s), using the base", o.MaxEjection, o.BaseEjection))
+		o.MaxEjection = o.BaseEjection
+	}
+
+	return warnings
+}
+
+// Applies default values to sticky session configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyStickySessionDefaults(s *StickySessionConfig) []string {
+	warnings := []string{}
+
+	if !s.Enabled {
+		return warnings
+	}
+
+	if s.Cookie == "" {
+		s.Cookie = DefaultStickyCookie
+		warnings = append(warnings, fmt.Sprintf("Sticky session cookie name not specified, using default: %s", DefaultStickyCookie))
+	}
+
+	if s.TTL == 0 {
+		s.TTL = DefaultStickyTTL
+		warnings = append(warnings, fmt.Sprintf("Sticky session ttl not specified, using default: %d seconds", DefaultStickyTTL))
+	}
+
+	if s.Path == "" {
+		s.Path = DefaultStickyPath
+	}
+
+	s.SameSite = strings.ToLower(s.SameSite)
+	if s.SameSite == "" {
+		s.SameSite = DefaultStickySameSite
+	}
+
+	return warnings
+}
+
+// Applies default values to virtual host configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyVirtualHostDefaults(vh *VirtualHostsConfig) []string {
+	warnings := []string{}
+
+	if len(vh.Hosts) > 0 && vh.UnknownStatus == 0 {
+		vh.UnknownStatus = DefaultUnknownHostStatus
+	}
+
+	return warnings
+}
+
+// Applies default values to access log configuration and returns a slice of warning messages for any defaults that were applied
+func ApplyAccessLogDefaults(al *AccessLogConfig) []string {
+	warnings := []string{}
+
+	if al.Format == "" {
+		al.Format = DefaultAccessLogFormat
+	}
+
+	if len(al.Sinks) == 0 {
+		al.Sinks = []AccessLogSinkConfig{{Type: "stdout"}}
+	}
+
+	for i := range al.Sinks {
+		s := &al.Sinks[i]
+
+		if s.Type == "file" && s.MaxSize == 0 {
+			s.MaxSize = DefaultAccessLogMaxSize
+			warnings = append(warnings, fmt.Sprintf("Access log file '%s': max size not specified, using default: %d MB", s.Path, DefaultAccessLogMaxSize))
+		}
+
+		if s.Type == "syslog" && s.Tag == "" {
+			s.Tag = DefaultSyslogTag
+		}
+	}
+
+	return warnings
+}
+
 func ApplyProxyDefaults(p *ProxyConfig) []string {
 	warnings := []string{}
 
 	if p.Host == "" {
 		p.Host = DefaultProxyHost
-		warnings = append(warnings, fmt.Sprintf("Proxy host no specified, using default: %d", DefaultProxyHost))
+		warnings = append(warnings, fmt.Sprintf("Proxy host no specified, using default: %s", DefaultProxyHost))
 	}
 
 	if p.Port == "" {
 		p.Port = DefaultProxyPort
-		warnings = append(warnings, fmt.Sprintf("Proxy Port no specified, using default: %d", DefaultProxyPort))
+		warnings = append(warnings, fmt.Sprintf("Proxy Port no specified, using default: %s", DefaultProxyPort))
 	}
 
 	if p.AdminPort == "" {
 		p.AdminPort = DefaultAdminPort
-		warnings = append(warnings, fmt.Sprintf("Proxy AdminPort no specified, using default: %d", DefaultAdminPort))
+		warnings = append(warnings, fmt.Sprintf("Proxy AdminPort no specified, using default: %s", DefaultAdminPort))
 	}
 
 	return warnings
@@ -110,7 +446,22 @@ func ApplyAllDefaults(cfg *Config) []string {
 	warnings = append(warnings, ApplyBackendDefaults(cfg.Backed)...)
 	warnings = append(warnings, ApplyLoadBalancerDefaults(&cfg.LoadBalancer)...)
 	warnings = append(warnings, ApplyHealthCheckDefaults(&cfg.HealthCheck)...)
+	warnings = append(warnings, ApplyRetryDefaults(&cfg.Retry)...)
+	warnings = append(warnings, ApplyCircuitBreakerDefaults(&cfg.Breaker)...)
+	warnings = append(warnings, ApplyOutlierDefaults(&cfg.Outlier)...)
+	for i := range cfg.Upstreams {
+		u := &cfg.Upstreams[i]
+		warnings = append(warnings, ApplyBackendDefaults(u.Backends)...)
+		warnings = append(warnings, ApplyLoadBalancerDefaults(&u.LoadBalancer)...)
+		warnings = append(warnings, ApplyHealthCheckDefaults(&u.HealthCheck)...)
+		warnings = append(warnings, ApplyRetryDefaults(&u.Retry)...)
+		warnings = append(warnings, ApplyCircuitBreakerDefaults(&u.Breaker)...)
+		warnings = append(warnings, ApplyOutlierDefaults(&u.Outlier)...)
+	}
 	warnings = append(warnings, ApplyProxyDefaults(&cfg.Proxy)...)
+	warnings = append(warnings, ApplyStickySessionDefaults(&cfg.Sticky)...)
+	warnings = append(warnings, ApplyVirtualHostDefaults(&cfg.VirtualHosts)...)
+	warnings = append(warnings, ApplyAccessLogDefaults(&cfg.AccessLog)...)
 
 	return warnings
 }
@@ -26,7 +26,22 @@ func Load(path string) (*Config, error) {
 	}
 
 	// Validate configs (fatal errors only)
-	err = validateBackendConfig(cfg.Backed)
+	err = validateUpstreamConfig(cfg.AllUpstreams())
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateRouteConfig(cfg.Routes, cfg.AllUpstreams())
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateVirtualHostConfig(cfg.VirtualHosts, cfg.AllUpstreams())
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateAccessLogConfig(cfg.AccessLog)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +51,7 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
-	err = validateLoadBalancerConfig(cfg.LoadBalancer)
+	err = validateStickySessionConfig(cfg.Sticky)
 	if err != nil {
 		return nil, err
 	}
@@ -3,10 +3,177 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 )
 
+func validateUpstreamConfig(cfg []UpstreamConfig) error {
+
+	// At least one upstream, either the default one or a named one
+	if len(cfg) < 1 {
+		return errors.New("no backends configured")
+	}
+
+	names := make(map[string]bool, len(cfg))
+	for _, u := range cfg {
+		// Upstream name (non-empty, unique)
+		if u.Name == "" {
+			return errors.New("all upstreams should have names attributed")
+		}
+		if names[u.Name] {
+			return fmt.Errorf("upstream '%s' is defined more than once", u.Name)
+		}
+		names[u.Name] = true
+
+		if err := validateBackendConfig(u.Backends); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+
+		if err := validateLoadBalancerConfig(u.LoadBalancer); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+
+		if err := validateHealthCheckConfig(u.HealthCheck); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+
+		if err := validateRetryConfig(u.Retry); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+
+		if err := validateCircuitBreakerConfig(u.Breaker); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+
+		if err := validateOutlierConfig(u.Outlier); err != nil {
+			return fmt.Errorf("upstream '%s': %w", u.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateRouteConfig(cfg []RouteConfig, upstreams []UpstreamConfig) error {
+
+	names := make(map[string]bool, len(upstreams))
+	for _, u := range upstreams {
+		names[u.Name] = true
+	}
+
+	for i, r := range cfg {
+		// Route target (existing upstream)
+		if !names[r.Upstream] {
+			return fmt.Errorf("route %d ('%s') points to unknown upstream '%s'", i, r.Name, r.Upstream)
+		}
+
+		// Route path prefix (if not empty, must start with /)
+		if r.Match.PathPrefix != "" && r.Match.PathPrefix[0] != '/' {
+			return fmt.Errorf("route %d ('%s') path prefix must start with '/'", i, r.Name)
+		}
+
+		// Route rewrite prefixes (if not empty, must start with /) and regex (valid)
+		if r.Rewrite.StripPrefix != "" && r.Rewrite.StripPrefix[0] != '/' {
+			return fmt.Errorf("route %d ('%s') strip prefix must start with '/'", i, r.Name)
+		}
+		if r.Rewrite.AddPrefix != "" && r.Rewrite.AddPrefix[0] != '/' {
+			return fmt.Errorf("route %d ('%s') add prefix must start with '/'", i, r.Name)
+		}
+		if _, err := regexp.Compile(r.Rewrite.Regex); err != nil {
+			return fmt.Errorf("route %d ('%s') has an invalid rewrite regex: %w", i, r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateVirtualHostConfig(cfg VirtualHostsConfig, upstreams []UpstreamConfig) error {
+
+	if len(cfg.Hosts) == 0 {
+		return nil
+	}
+
+	names := make(map[string]bool, len(upstreams))
+	for _, u := range upstreams {
+		names[u.Name] = true
+	}
+
+	vhosts := make(map[string]bool, len(cfg.Hosts))
+	owners := make(map[string]string)
+	for _, v := range cfg.Hosts {
+		// Vhost name (non-empty, unique)
+		if v.Name == "" {
+			return errors.New("all virtual hosts should have names attributed")
+		}
+		if vhosts[v.Name] {
+			return fmt.Errorf("virtual host '%s' is defined more than once", v.Name)
+		}
+		vhosts[v.Name] = true
+
+		// Vhost target (existing upstream)
+		if !names[v.Upstream] {
+			return fmt.Errorf("virtual host '%s' points to unknown upstream '%s'", v.Name, v.Upstream)
+		}
+
+		// Vhost host patterns (at least one, valid regex, names and wildcards owned by one vhost)
+		if len(v.Hosts) == 0 {
+			return fmt.Errorf("virtual host '%s' has no host patterns", v.Name)
+		}
+		for _, h := range v.Hosts {
+			if strings.HasPrefix(h, "~") {
+				if _, err := regexp.Compile(h[1:]); err != nil {
+					return fmt.Errorf("virtual host '%s' has an invalid regex %q: %w", v.Name, h, err)
+				}
+				continue
+			}
+
+			host := strings.ToLower(h)
+			if owner, ok := owners[host]; ok && owner != v.Name {
+				return fmt.Errorf("host '%s' is claimed by both virtual hosts '%s' and '%s'", h, owner, v.Name)
+			}
+			owners[host] = v.Name
+		}
+	}
+
+	if cfg.Default != "" && !vhosts[cfg.Default] {
+		return fmt.Errorf("default virtual host '%s' is not defined", cfg.Default)
+	}
+
+	if cfg.UnknownStatus != http.StatusMisdirectedRequest && cfg.UnknownStatus != http.StatusNotFound {
+		return fmt.Errorf("unknown host status %d must be 421 or 404", cfg.UnknownStatus)
+	}
+
+	return nil
+}
+
+func validateAccessLogConfig(cfg AccessLogConfig) error {
+
+	if cfg.Format != "json" && cfg.Format != "logfmt" {
+		return fmt.Errorf("%s is not a valid access log format, expected json or logfmt", cfg.Format)
+	}
+
+	for _, s := range cfg.Sinks {
+		switch s.Type {
+		case "stdout":
+		case "file":
+			if s.Path == "" {
+				return errors.New("access log file sink requires a path")
+			}
+		case "syslog":
+			if (s.Network == "") != (s.Address == "") {
+				return errors.New("access log syslog sink requires both network and address, or neither for the local daemon")
+			}
+		default:
+			return fmt.Errorf("%s is not a valid access log sink, expected stdout, file or syslog", s.Type)
+		}
+	}
+
+	return nil
+}
+
 func validateBackendConfig(cfg []BackendConfig) error {
 
 	// At least one backend
@@ -14,11 +181,16 @@ func validateBackendConfig(cfg []BackendConfig) error {
 		return errors.New("no backends configured")
 	}
 
+	names := make(map[string]bool, len(cfg))
 	for _, b := range cfg {
-		// Backend name (non-empty)
+		// Backend name (non-empty, unique)
 		if b.Name == "" {
 			return errors.New("all backends should have names attributed")
 		}
+		if names[b.Name] {
+			return fmt.Errorf("backend '%s' is defined more than once", b.Name)
+		}
+		names[b.Name] = true
 
 		// Backend URL (non-empty, valid format)
 		if !isValidUrl(b.Host) {
@@ -29,6 +201,70 @@ func validateBackendConfig(cfg []BackendConfig) error {
 		if b.Health != "" && b.Health[0] != '/' {
 			return fmt.Errorf("backend '%s' health check path must start with '/'", b.Name)
 		}
+
+		// Backend priority (non-negative)
+		if b.Priority < 0 {
+			return fmt.Errorf("backend '%s' priority must not be negative", b.Name)
+		}
+
+		if err := validateHealthProbeConfig(b.Check); err != nil {
+			return fmt.Errorf("backend '%s': %w", b.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateHealthCheckConfig(cfg HealthCheckConfig) error {
+
+	if *cfg.Jitter < 0 || *cfg.Jitter >= 1 {
+		return fmt.Errorf("health check jitter %.2f must be at least 0 and below 1", *cfg.Jitter)
+	}
+
+	return nil
+}
+
+func validateHealthProbeConfig(cfg HealthProbeConfig) error {
+
+	switch cfg.Type {
+	case "http", "tcp", "tls", "grpc":
+	case "exec":
+		if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+			return errors.New("exec health check requires a command")
+		}
+	default:
+		return fmt.Errorf("%s is not a valid health check type, expected http, tcp, tls, grpc or exec", cfg.Type)
+	}
+
+	methods := map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodOptions: true,
+	}
+
+	if !methods[cfg.Method] {
+		return fmt.Errorf("%s is not a valid health check method, expected GET, HEAD, POST or OPTIONS", cfg.Method)
+	}
+
+	for _, s := range cfg.Statuses {
+		if !isValidStatusRange(s) {
+			return fmt.Errorf("%s is not a valid health check status, expected a code, a class like 2xx or a range like 200-399", s)
+		}
+	}
+
+	if cfg.Port != "" {
+		if err := isValidPort(cfg.Port); err != nil {
+			return fmt.Errorf("invalid health check port: %w", err)
+		}
+	}
+
+	if _, err := regexp.Compile(cfg.BodyRegex); err != nil {
+		return fmt.Errorf("invalid health check body regex: %w", err)
+	}
+
+	if cfg.JSONValue != "" && cfg.JSONPath == "" {
+		return errors.New("health check json-value requires a json-path")
 	}
 
 	return nil
@@ -53,6 +289,13 @@ func validateProxyConfig(cfg ProxyConfig) error {
 		return fmt.Errorf("invalid proxy admin port")
 	}
 
+	// Validate trusted proxies (CIDR or single address)
+	for _, c := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(c); err != nil && net.ParseIP(c) == nil {
+			return fmt.Errorf("%s is not a valid trusted proxy CIDR", c)
+		}
+	}
+
 	return nil
 }
 
@@ -63,13 +306,175 @@ func validateLoadBalancerConfig(cfg LoadBalancerConfig) error {
 		"least-connections": true,
 		"weighted":          true,
 		"random":            true,
+		"p2c":               true,
+		"peak-ewma":         true,
+		"consistent-hash":   true,
+		"maglev":            true,
+	}
+
+	if !valid[cfg.Method] {
+		return fmt.Errorf("%s is not a valid load-balancer method, defaulting to round-robin", cfg.Method)
+	}
+
+	signals := map[string]bool{
+		"in-flight": true,
+		"latency":   true,
+		"combined":  true,
+	}
+
+	if cfg.Method == "p2c" && !signals[cfg.LoadSignal] {
+		return fmt.Errorf("%s is not a valid p2c load signal, expected in-flight, latency or combined", cfg.LoadSignal)
+	}
+
+	if (cfg.Method == "consistent-hash" || cfg.Method == "maglev") && !isValidHashKey(cfg.HashKey) {
+		return fmt.Errorf("%s is not a valid hash key, expected client-ip, path, header:<name>, cookie:<name> or query:<name>", cfg.HashKey)
 	}
 
-	if valid[cfg.Method] {
+	if *cfg.Failover < 0 || *cfg.Failover > 1 {
+		return fmt.Errorf("failover threshold %.2f must be between 0 and 1", *cfg.Failover)
+	}
+
+	if *cfg.ZoneAware.MinHealthy < 0 || *cfg.ZoneAware.MinHealthy > 1 {
+		return fmt.Errorf("zone-aware min-healthy %.2f must be between 0 and 1", *cfg.ZoneAware.MinHealthy)
+	}
+
+	if cfg.ZoneAware.Overload < 1 {
+		return fmt.Errorf("zone-aware overload-factor %.2f must be at least 1", cfg.ZoneAware.Overload)
+	}
+
+	if cfg.Method == "maglev" && !isPrime(cfg.TableSize) {
+		return fmt.Errorf("maglev table size %d must be a prime number", cfg.TableSize)
+	}
+
+	return nil
+}
+
+func validateRetryConfig(cfg RetryConfig) error {
+
+	methods := map[string]bool{
+		http.MethodPost:  true,
+		http.MethodPatch: true,
+	}
+
+	for _, m := range cfg.Methods {
+		if !methods[m] {
+			return fmt.Errorf("%s is not a valid retry method, idempotent methods are always retried and only POST or PATCH may be added", m)
+		}
+	}
+
+	for _, code := range cfg.Statuses {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("retry status %d must be an error code between 400 and 599", code)
+		}
+	}
+
+	if *cfg.Budget.Ratio < 0 {
+		return fmt.Errorf("retry budget ratio %.2f must not be negative", *cfg.Budget.Ratio)
+	}
+
+	return nil
+}
+
+func validateCircuitBreakerConfig(cfg CircuitBreakerConfig) error {
+
+	if cfg.FailureRatio < 0 || cfg.FailureRatio > 1 {
+		return fmt.Errorf("circuit breaker failure ratio %.2f must be between 0 and 1", cfg.FailureRatio)
+	}
+
+	return nil
+}
+
+func validateOutlierConfig(cfg OutlierConfig) error {
+
+	if !cfg.Enabled {
 		return nil
 	}
 
-	return fmt.Errorf("%s is not a valid load-balancer method, defaulting to round-robin", cfg.Method)
+	if cfg.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier max ejection percent %d must be at most 100", cfg.MaxEjectionPercent)
+	}
+
+	if cfg.SuccessRateStdev < 0 {
+		return fmt.Errorf("outlier success rate stdev factor %.2f must not be negative", cfg.SuccessRateStdev)
+	}
+
+	if cfg.LatencyFactor < 1 {
+		return fmt.Errorf("outlier latency factor %.2f must be at least 1", cfg.LatencyFactor)
+	}
+
+	return nil
+}
+
+func validateStickySessionConfig(cfg StickySessionConfig) error {
+
+	if !cfg.Enabled {
+		return nil
+	}
+
+	// Signing key (long enough to resist brute force)
+	if len(cfg.Key) < 16 {
+		return errors.New("sticky session key must be at least 16 characters long")
+	}
+
+	switch cfg.SameSite {
+	case "lax", "strict":
+	case "none":
+		// Browsers reject SameSite=None cookies that are not Secure
+		if !cfg.Secure {
+			return errors.New("sticky session same-site none requires secure to be enabled")
+		}
+	default:
+		return fmt.Errorf("%s is not a valid sticky session same-site value, expected lax, strict or none", cfg.SameSite)
+	}
+
+	if cfg.Path[0] != '/' {
+		return errors.New("sticky session cookie path must start with '/'")
+	}
+
+	return nil
+}
+
+func isValidHashKey(key string) bool {
+	kind, name, _ := strings.Cut(key, ":")
+
+	switch kind {
+	case "client-ip", "path":
+		return name == ""
+	case "header", "cookie", "query":
+		return name != ""
+	}
+
+	return false
+}
+
+func isValidStatusRange(s string) bool {
+	valid := func(code string) bool {
+		n, err := strconv.Atoi(code)
+		return err == nil && n >= 100 && n <= 599
+	}
+
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		return s[0] >= '1' && s[0] <= '5'
+	}
+
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		return valid(lo) && valid(hi) && lo <= hi
+	}
+	return valid(s)
+}
+
+func isPrime(n uint) bool {
+	if n < 2 {
+		return false
+	}
+
+	for i := uint(2); i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+
+	return true
 }
 
 func isValidUrl(str string) bool {
@@ -0,0 +1,255 @@
+package forwarded
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver derives the real client address of a request and builds the forwarding headers
+// sent to backends. Forwarding headers are only trusted when the peer is a trusted proxy.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// Creates a resolver trusting the given CIDRs. Plain addresses are accepted as single-host ranges.
+func New(cidrs []string) (*Resolver, error) {
+	rs := &Resolver{}
+
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", c)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			c = fmt.Sprintf("%s/%d", c, bits)
+		}
+
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+		}
+		rs.trusted = append(rs.trusted, network)
+	}
+
+	return rs, nil
+}
+
+func (rs *Resolver) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, n := range rs.trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the direct peer of the request is a trusted proxy
+func (rs *Resolver) TrustsPeer(r *http.Request) bool {
+	return rs.isTrusted(peer(r))
+}
+
+// Returns the address of the client that originated the request. The X-Forwarded-For chain
+// (or Forwarded when absent) is walked from the right, skipping trusted proxies, and the
+// first untrusted hop is the client. Chains sent by untrusted peers are ignored.
+func (rs *Resolver) resolve(r *http.Request) string {
+	ip := peer(r)
+	if !rs.isTrusted(ip) {
+		return ip
+	}
+
+	chain := forwardedFor(r.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !rs.isTrusted(chain[i]) {
+			return chain[i]
+		}
+		ip = chain[i]
+	}
+	return ip
+}
+
+// Sets X-Forwarded-For/Proto/Host/Port and RFC 7239 Forwarded on an outgoing request. When
+// the peer is trusted the incoming chains are extended, otherwise they are discarded and
+// replaced with values describing this hop only.
+func (rs *Resolver) SetHeaders(out, in *http.Request) {
+	ip := peer(in)
+	trusted := rs.isTrusted(ip)
+
+	proto := rs.scheme(in)
+	host := in.Host
+	port := localPort(in)
+
+	xff, fwd := "", ""
+	if trusted {
+		xff = strings.Join(in.Header.Values("X-Forwarded-For"), ", ")
+		fwd = strings.Join(in.Header.Values("Forwarded"), ", ")
+
+		// Keep what the trusted proxy in front of us saw
+		if v := in.Header.Get("X-Forwarded-Host"); v != "" {
+			host = v
+		}
+		if v := in.Header.Get("X-Forwarded-Port"); v != "" {
+			port = v
+		}
+	}
+
+	for _, h := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Forwarded-Port", "Forwarded"} {
+		out.Header.Del(h)
+	}
+
+	if xff != "" {
+		xff += ", "
+	}
+	out.Header.Set("X-Forwarded-For", xff+ip)
+	out.Header.Set("X-Forwarded-Proto", proto)
+	out.Header.Set("X-Forwarded-Host", host)
+	if port != "" {
+		out.Header.Set("X-Forwarded-Port", port)
+	}
+
+	element := fmt.Sprintf("for=%s;host=%s;proto=%s", forNode(ip), quote(in.Host), proto)
+	if fwd != "" {
+		element = fwd + ", " + element
+	}
+	out.Header.Set("Forwarded", element)
+}
+
+// Returns the scheme the client used to reach the proxy. Behind a trusted proxy terminating TLS
+// it comes from X-Forwarded-Proto, or the proto= parameter of Forwarded when the former is absent.
+func (rs *Resolver) scheme(r *http.Request) string {
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	if !rs.isTrusted(peer(r)) {
+		return proto
+	}
+
+	// The leftmost value is the one seen by the proxy closest to the client
+	if v := r.Header.Get("X-Forwarded-Proto"); v != "" {
+		first, _, _ := strings.Cut(v, ",")
+		return strings.ToLower(strings.TrimSpace(first))
+	}
+
+	if v := r.Header.Get("Forwarded"); v != "" {
+		element, _, _ := strings.Cut(v, ",")
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "proto") {
+				return strings.ToLower(strings.Trim(value, `"`))
+			}
+		}
+	}
+	return proto
+}
+
+type clientIPKey struct{}
+
+type schemeKey struct{}
+
+// Returns a shallow copy of r carrying its resolved client address and scheme, so logging,
+// balancing and rewriting can share them through ClientIP and Scheme
+func (rs *Resolver) Annotate(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), clientIPKey{}, rs.resolve(r))
+	ctx = context.WithValue(ctx, schemeKey{}, rs.scheme(r))
+	return r.WithContext(ctx)
+}
+
+// Returns the client address attached by Annotate, or the direct peer when there is none
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peer(r)
+}
+
+// Returns the scheme attached by Annotate, or the one of the direct connection when there is none
+func Scheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(schemeKey{}).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func peer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func localPort(r *http.Request) string {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// Returns the addresses of X-Forwarded-For, or the for= parameters of Forwarded when the
+// former is absent, from the original client to the closest proxy
+func forwardedFor(h http.Header) []string {
+	chain := make([]string, 0)
+
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, v := range values {
+			for _, ip := range strings.Split(v, ",") {
+				if ip = strings.TrimSpace(ip); ip != "" {
+					chain = append(chain, ip)
+				}
+			}
+		}
+		return chain
+	}
+
+	for _, v := range h.Values("Forwarded") {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				if host, _, err := net.SplitHostPort(value); err == nil {
+					value = host
+				}
+				chain = append(chain, strings.Trim(value, "[]"))
+			}
+		}
+	}
+	return chain
+}
+
+// Formats an address as a Forwarded node, IPv6 addresses must be bracketed and quoted
+func forNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quote(s string) string {
+	if strings.ContainsAny(s, ":;, \"") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package headers
+
+import (
+	"context"
+	"net/http"
+	"proxymity/internal/config"
+	"regexp"
+	"strings"
+)
+
+// Rules holds the header operations applied to requests before forwarding and to responses
+// before returning them
+type Rules struct {
+	request  ops
+	response ops
+}
+
+type ops struct {
+	remove []string
+	rename map[string]string
+	set    map[string]string
+	append map[string]string
+}
+
+// Builds header rules from their configuration, nil when the configuration changes nothing
+func New(cfg config.HeaderRulesConfig) *Rules {
+	r := &Rules{
+		request:  newOps(cfg.Request),
+		response: newOps(cfg.Response),
+	}
+
+	if r.request.empty() && r.response.empty() {
+		return nil
+	}
+	return r
+}
+
+func newOps(cfg config.HeaderOpsConfig) ops {
+	return ops{
+		remove: cfg.Remove,
+		rename: cfg.Rename,
+		set:    cfg.Set,
+		append: cfg.Append,
+	}
+}
+
+func (o ops) empty() bool {
+	return len(o.remove) == 0 && len(o.rename) == 0 && len(o.set) == 0 && len(o.append) == 0
+}
+
+// Applies the request operations to the headers of an outgoing request
+func (r *Rules) ApplyRequest(h http.Header, vars Vars) {
+	if r != nil {
+		r.request.apply(h, vars)
+	}
+}
+
+// Applies the response operations to the headers of a backend response
+func (r *Rules) ApplyResponse(h http.Header, vars Vars) {
+	if r != nil {
+		r.response.apply(h, vars)
+	}
+}
+
+// Operations run in a fixed order: remove, rename, set, append
+func (o ops) apply(h http.Header, vars Vars) {
+	for _, name := range o.remove {
+		remove(h, name)
+	}
+
+	for from, to := range o.rename {
+		if values := h.Values(from); len(values) > 0 {
+			h.Del(from)
+			h[http.CanonicalHeaderKey(to)] = values
+		}
+	}
+
+	for name, value := range o.set {
+		h.Set(name, vars.Expand(value))
+	}
+
+	for name, value := range o.append {
+		h.Add(name, vars.Expand(value))
+	}
+}
+
+// Removes a header, or every header starting with the given prefix when name ends with "*"
+func remove(h http.Header, name string) {
+	prefix, wildcard := strings.CutSuffix(name, "*")
+	if !wildcard {
+		h.Del(name)
+		return
+	}
+
+	prefix = strings.ToLower(prefix)
+	for key := range h {
+		if strings.HasPrefix(strings.ToLower(key), prefix) {
+			delete(h, key)
+		}
+	}
+}
+
+// Vars are the values available to header rules as ${name}
+type Vars map[string]string
+
+var varPattern = regexp.MustCompile(`\$\{([a-z_]+)\}`)
+
+// Replaces every ${name} in s with its value. Unknown variables are left as they are.
+func (v Vars) Expand(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if value, ok := v[m[2:len(m)-1]]; ok {
+			return value
+		}
+		return m
+	})
+}
+
+type rulesKey struct{}
+
+// Returns a shallow copy of r carrying route level rules for the proxy to apply
+func WithRules(r *http.Request, rules *Rules) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rulesKey{}, rules))
+}
+
+// Returns the route level rules attached to the request context, if any
+func FromContext(ctx context.Context) *Rules {
+	rules, _ := ctx.Value(rulesKey{}).(*Rules)
+	return rules
+}
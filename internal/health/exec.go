@@ -0,0 +1,49 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"proxymity/internal/backend"
+	"strings"
+	"time"
+)
+
+// How long a killed command may take to release its output
+const execWaitDelay = time.Second
+
+// Runs a local command and passes when it exits with code 0. The backend is described to the
+// command through the BACKEND_NAME, BACKEND_URL, BACKEND_HOST and BACKEND_PORT variables.
+type execProbe struct {
+	command []string
+}
+
+func (p *execProbe) Check(ctx context.Context, b *backend.Backend) error {
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BACKEND_NAME="+b.Name,
+		"BACKEND_URL="+b.Host.String(),
+		"BACKEND_HOST="+b.Host.Hostname(),
+		"BACKEND_PORT="+b.Host.Port(),
+	)
+
+	killProcessGroup(cmd)
+
+	// Processes left behind may keep the output pipe open, stop waiting for them shortly
+	// after the command was killed
+	cmd.WaitDelay = execWaitDelay
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("%w: %.200s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
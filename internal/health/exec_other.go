@@ -0,0 +1,8 @@
+//go:build !unix
+
+package health
+
+import "os/exec"
+
+// Process groups are not available, only the command itself is killed on timeout
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package health
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Runs the command in its own process group and kills the whole group on timeout, so
+// processes it started cannot outlive the check
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,174 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+)
+
+// Status values of grpc.health.v1.HealthCheckResponse
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// Calls the standard grpc.health.v1.Health/Check method and passes when the backend reports
+// SERVING. Backends with an https URL are reached over TLS, others over cleartext HTTP/2.
+type grpcProbe struct {
+	client  *http.Client
+	port    string
+	service string
+}
+
+func newGRPCProbe(cfg config.HealthProbeConfig) *grpcProbe {
+	t := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			ServerName:         cfg.ServerName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+		Protocols: new(http.Protocols),
+	}
+	t.Protocols.SetHTTP2(true)
+	t.Protocols.SetUnencryptedHTTP2(true)
+
+	return &grpcProbe{
+		client:  &http.Client{Transport: t},
+		port:    cfg.Port,
+		service: cfg.Service,
+	}
+}
+
+func (p *grpcProbe) Check(ctx context.Context, b *backend.Backend) error {
+	scheme := "http"
+	if b.Host.Scheme == "https" {
+		scheme = "https"
+	}
+	target := scheme + "://" + probeAddress(b.Host, p.port) + "/grpc.health.v1.Health/Check"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(grpcFrame(grpcCheckRequest(p.service))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return err
+	}
+
+	// Errors come as a trailers-only response, where the status is sent with the headers
+	code := resp.Trailer.Get("Grpc-Status")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+	}
+	if code != "0" {
+		return fmt.Errorf("grpc status %s: %s", code, resp.Trailer.Get("Grpc-Message")+resp.Header.Get("Grpc-Message"))
+	}
+
+	status, err := grpcCheckResponse(body)
+	if err != nil {
+		return err
+	}
+	if status != 1 {
+		name, ok := grpcServingStatus[status]
+		if !ok {
+			name = fmt.Sprint(status)
+		}
+		return fmt.Errorf("serving status %s", name)
+	}
+	return nil
+}
+
+// Encodes a HealthCheckRequest, its only field is the service name (field 1, length-delimited)
+func grpcCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	msg := []byte{0x0a}
+	msg = binary.AppendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// Prefixes a message with the gRPC length-prefixed message header: an uncompressed flag and
+// the big-endian message length
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// Decodes the status (field 1, varint) of a framed HealthCheckResponse, skipping unknown fields
+func grpcCheckResponse(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("truncated grpc response")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("compressed grpc responses are not supported")
+	}
+	size := binary.BigEndian.Uint32(frame[1:5])
+	if uint32(len(frame)-5) < size {
+		return 0, errors.New("truncated grpc response")
+	}
+	msg := frame[5 : 5+size]
+
+	// A message with every field at its default value is empty, status UNKNOWN
+	var status uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed grpc response")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n+int(l):]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[4:]
+		default:
+			return 0, errors.New("malformed grpc response")
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,122 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+	"testing"
+)
+
+func TestGRPCCheckRequest(t *testing.T) {
+	if got := grpcCheckRequest(""); len(got) != 0 {
+		t.Errorf("grpcCheckRequest(\"\") = %x, want an empty message", got)
+	}
+
+	want := []byte{0x0a, 0x03, 'a', 'p', 'i'}
+	if got := grpcCheckRequest("api"); !bytes.Equal(got, want) {
+		t.Errorf("grpcCheckRequest(\"api\") = %x, want %x", got, want)
+	}
+}
+
+func TestGRPCFrame(t *testing.T) {
+	want := []byte{0, 0, 0, 0, 2, 0x08, 0x01}
+	if got := grpcFrame([]byte{0x08, 0x01}); !bytes.Equal(got, want) {
+		t.Errorf("grpcFrame = %x, want %x", got, want)
+	}
+}
+
+func TestGRPCCheckResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   []byte
+		want    uint64
+		wantErr bool
+	}{
+		{name: "serving", frame: []byte{0, 0, 0, 0, 2, 0x08, 0x01}, want: 1},
+		{name: "not serving", frame: []byte{0, 0, 0, 0, 2, 0x08, 0x02}, want: 2},
+		{name: "empty message is unknown", frame: []byte{0, 0, 0, 0, 0}, want: 0},
+		{name: "unknown varint field skipped", frame: []byte{0, 0, 0, 0, 4, 0x10, 0x07, 0x08, 0x01}, want: 1},
+		{name: "unknown length-delimited field skipped", frame: []byte{0, 0, 0, 0, 6, 0x12, 0x02, 'h', 'i', 0x08, 0x01}, want: 1},
+		{name: "unknown fixed fields skipped", frame: append([]byte{0, 0, 0, 0, 16, 0x19, 1, 2, 3, 4, 5, 6, 7, 8, 0x25, 1, 2, 3, 4}, 0x08, 0x01), want: 1},
+		{name: "trailing bytes after the frame ignored", frame: []byte{0, 0, 0, 0, 2, 0x08, 0x01, 0xff}, want: 1},
+		{name: "truncated header", frame: []byte{0, 0, 0}, wantErr: true},
+		{name: "truncated message", frame: []byte{0, 0, 0, 0, 4, 0x08, 0x01}, wantErr: true},
+		{name: "compressed", frame: []byte{1, 0, 0, 0, 2, 0x08, 0x01}, wantErr: true},
+		{name: "truncated varint", frame: []byte{0, 0, 0, 0, 2, 0x08, 0x80}, wantErr: true},
+		{name: "truncated length-delimited field", frame: []byte{0, 0, 0, 0, 3, 0x12, 0x05, 'h'}, wantErr: true},
+		{name: "truncated fixed64", frame: []byte{0, 0, 0, 0, 3, 0x19, 1, 2}, wantErr: true},
+		{name: "invalid wire type", frame: []byte{0, 0, 0, 0, 2, 0x0b, 0x01}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := grpcCheckResponse(tt.frame)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("grpcCheckResponse(%x) error = %v, want error %v", tt.frame, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("grpcCheckResponse(%x) = %d, want %d", tt.frame, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeAddress(t *testing.T) {
+	tests := []struct {
+		url  string
+		port string
+		want string
+	}{
+		{"http://localhost:8081", "", "localhost:8081"},
+		{"http://localhost:8081", "9000", "localhost:9000"},
+		{"http://example.com", "", "example.com:80"},
+		{"https://example.com", "", "example.com:443"},
+		{"http://[::1]:8081", "", "[::1]:8081"},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := probeAddress(u, tt.port); got != tt.want {
+			t.Errorf("probeAddress(%q, %q) = %q, want %q", tt.url, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestGRPCProbe(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/grpc.health.v1.Health/Check" || r.Header.Get("Content-Type") != "application/grpc" {
+			w.Header().Set("Grpc-Status", "12")
+			return
+		}
+
+		// Anything but the whole server is not serving
+		status := byte(1)
+		if len(body) > 5 {
+			status = 2
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(grpcFrame([]byte{0x08, status}))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	b := &backend.Backend{Name: "grpc", Host: u}
+
+	if err := newGRPCProbe(config.HealthProbeConfig{}).Check(context.Background(), b); err != nil {
+		t.Errorf("server check failed: %v", err)
+	}
+	if err := newGRPCProbe(config.HealthProbeConfig{Service: "api"}).Check(context.Background(), b); err == nil || err.Error() != "serving status NOT_SERVING" {
+		t.Errorf("service check error = %v, want serving status NOT_SERVING", err)
+	}
+}
@@ -1,22 +1,42 @@
 package health
 
 import (
-	"io"
-	"net/http"
+	"context"
+	"log"
+	"math/rand"
 	"proxymity/internal/backend"
 	"proxymity/internal/config"
 	"proxymity/internal/metrics"
+	"sync"
 	"time"
 )
 
 type HealthChecker struct {
-	pool    *backend.Pool
-	metrics *metrics.Metrics
-	ticker  *time.Ticker
-	timeout time.Duration
+	pool     *backend.Pool
+	metrics  *metrics.Metrics
+	interval time.Duration
+	timeout  time.Duration
+	jitter   float64
+	slots    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	configs  map[string]config.HealthProbeConfig
+	checks   map[*backend.Backend]*check
 }
 
-func NewHealthChecker(cfg config.HealthCheckConfig, pool *backend.Pool, m *metrics.Metrics) *HealthChecker {
+// Probe, schedule and rise/fall state of a single backend
+type check struct {
+	probe     Probe
+	interval  time.Duration
+	timeout   time.Duration
+	rise      int
+	fall      int
+	successes int
+	failures  int
+	checked   bool
+}
+
+func NewHealthChecker(cfg config.HealthCheckConfig, backends []config.BackendConfig, pool *backend.Pool, m *metrics.Metrics) *HealthChecker {
 
 	interval := time.Second * time.Duration(cfg.Interval)
 	if cfg.Interval < 1 {
@@ -28,58 +48,143 @@ func NewHealthChecker(cfg config.HealthCheckConfig, pool *backend.Pool, m *metri
 		timeout = 3 * time.Second // Default timeout to 3 seconds if not configured
 	}
 
+	configs := make(map[string]config.HealthProbeConfig, len(backends))
+	for _, bcfg := range backends {
+		configs[bcfg.Name] = bcfg.Check
+	}
+
 	return &HealthChecker{
-		pool:    pool,
-		metrics: m,
-		ticker:  time.NewTicker(interval),
-		timeout: timeout,
+		pool:     pool,
+		metrics:  m,
+		interval: interval,
+		timeout:  timeout,
+		jitter:   *cfg.Jitter,
+		slots:    make(chan struct{}, max(cfg.Concurrency, 1)),
+		stop:     make(chan struct{}),
+		configs:  configs,
 	}
 }
+
+// Probes every backend once, so their state reflects a real check before traffic is accepted,
+// then keeps probing each backend on its own schedule in the background until Stop is called
 func (h *HealthChecker) Start() {
+	backends := h.pool.GetBackends()
 
-	client := &http.Client{
-		Timeout: h.timeout,
+	h.checks = make(map[*backend.Backend]*check, len(backends))
+	for _, b := range backends {
+		h.checks[b] = h.newCheck(h.configs[b.Name])
 	}
 
-	for range h.ticker.C {
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.run(b)
+		}()
+	}
+	wg.Wait()
 
-		for _, b := range h.pool.GetBackends() {
+	for _, b := range backends {
+		go h.loop(b)
+	}
+}
 
-			healthUrl := b.Host.JoinPath(b.Health)
+func (h *HealthChecker) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
 
-			resp, err := client.Get(healthUrl.String())
-			if err != nil {
-				b.SetAlive(false)
-				continue
-			}
+// Probes a backend once and reports whether it passed, without changing its state
+func (h *HealthChecker) Backend(b *backend.Backend) bool {
+	c, ok := h.checks[b]
+	if !ok {
+		c = h.newCheck(h.configs[b.Name])
+	}
+	return h.probe(b, c) == nil
+}
 
-			// Read and discard the body to allow connection reuse, then close immediately.
-			_, _ = io.Copy(io.Discard, resp.Body)
-			resp.Body.Close()
+func (h *HealthChecker) newCheck(cfg config.HealthProbeConfig) *check {
+	c := &check{
+		probe:    NewProbe(cfg),
+		interval: h.interval,
+		timeout:  h.timeout,
+		rise:     int(max(cfg.HealthyThreshold, 1)),
+		fall:     int(max(cfg.UnhealthyThreshold, 1)),
+	}
 
-			if resp.StatusCode == http.StatusOK {
-				b.SetAlive(true)
-			} else {
-				b.SetAlive(false)
-			}
-		}
+	if cfg.Interval > 0 {
+		c.interval = time.Duration(cfg.Interval) * time.Second
+	}
+	if cfg.TimeOut > 0 {
+		c.timeout = time.Duration(cfg.TimeOut) * time.Second
 	}
+	return c
 }
 
-func (h *HealthChecker) Stop() {
-	h.ticker.Stop()
+// Probes b every interval, moved by a random jitter so probes of different backends drift
+// apart instead of firing in lock-step
+func (h *HealthChecker) loop(b *backend.Backend) {
+	c := h.checks[b]
+
+	for {
+		wait := c.interval
+		if h.jitter > 0 {
+			wait += time.Duration((rand.Float64()*2 - 1) * h.jitter * float64(c.interval))
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-h.stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		h.run(b)
+	}
 }
 
-func (h *HealthChecker) Backend(b *backend.Backend) bool {
-	client := &http.Client{
-		Timeout: h.timeout,
+// Waits for a free probe slot, then probes b and records the result
+func (h *HealthChecker) run(b *backend.Backend) {
+	select {
+	case h.slots <- struct{}{}:
+	case <-h.stop:
+		return
 	}
+	c := h.checks[b]
+	err := h.probe(b, c)
+	<-h.slots
 
-	resp, err := client.Get(b.Host.Path)
-	if err != nil {
-		return false
+	h.record(b, c, err)
+}
+
+func (h *HealthChecker) probe(b *backend.Backend, c *check) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	return c.probe.Check(ctx, b)
+}
+
+// Counts a probe result and flips the backend once enough results in a row agree. The first
+// result sets the state directly since nothing is known about the backend before it.
+func (h *HealthChecker) record(b *backend.Backend, c *check, err error) {
+	first := !c.checked
+	c.checked = true
+
+	if err == nil {
+		c.failures = 0
+		c.successes++
+		if (first || c.successes >= c.rise) && !b.IsAlive() {
+			log.Printf("Backend %s is healthy after %d passing checks", b.Name, c.successes)
+			b.SetAlive(true)
+		}
+		return
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
+	c.successes = 0
+	c.failures++
+	if first || (c.failures >= c.fall && b.IsAlive()) {
+		log.Printf("Backend %s is unhealthy after %d failing checks: %v", b.Name, c.failures, err)
+		b.SetAlive(false)
+	}
 }
@@ -0,0 +1,216 @@
+package health
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+	"proxymity/internal/metrics"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OutlierDetector ejects backends based on the outcome of the requests they serve. Runs of
+// 5xx responses or gateway errors eject a backend right away, while success rates and
+// latencies are compared against the rest of the pool once per interval.
+type OutlierDetector struct {
+	pool    *backend.Pool
+	metrics *metrics.Metrics
+	cfg     config.OutlierConfig
+	ticker  *time.Ticker
+
+	mu    sync.Mutex
+	stats map[*backend.Backend]*outlierStats
+
+	// Serializes ejections so concurrent ones cannot all pass the max ejection percent check
+	ejectMu sync.Mutex
+}
+
+type outlierStats struct {
+	requests    int
+	successes   int
+	latency     time.Duration
+	consecutive int // 5xx responses in a row
+	gateway     int // Gateway errors in a row
+}
+
+// Returns nil when outlier detection is disabled. Every method accepts a nil detector.
+func NewOutlierDetector(cfg config.OutlierConfig, pool *backend.Pool, m *metrics.Metrics) *OutlierDetector {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &OutlierDetector{
+		pool:    pool,
+		metrics: m,
+		cfg:     cfg,
+		ticker:  time.NewTicker(time.Duration(cfg.Interval) * time.Second),
+		stats:   make(map[*backend.Backend]*outlierStats),
+	}
+}
+
+// Records the outcome of a request sent to b. A zero status means no response was received.
+func (d *OutlierDetector) Observe(b *backend.Backend, status int, latency time.Duration) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	st, ok := d.stats[b]
+	if !ok {
+		st = &outlierStats{}
+		d.stats[b] = st
+	}
+
+	st.requests++
+	st.latency += latency
+
+	switch {
+	case status == 0 || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		st.gateway++
+		if status != 0 {
+			st.consecutive++
+		}
+	case status >= http.StatusInternalServerError:
+		st.gateway = 0
+		st.consecutive++
+	default:
+		st.gateway = 0
+		st.consecutive = 0
+		st.successes++
+	}
+
+	reason := ""
+	if st.consecutive >= int(d.cfg.Consecutive5xx) {
+		reason = fmt.Sprintf("%d consecutive 5xx responses", st.consecutive)
+	} else if st.gateway >= int(d.cfg.ConsecutiveGateway) {
+		reason = fmt.Sprintf("%d consecutive gateway errors", st.gateway)
+	}
+	if reason != "" {
+		st.consecutive, st.gateway = 0, 0
+	}
+	d.mu.Unlock()
+
+	if reason != "" {
+		d.eject(b, reason)
+	}
+}
+
+// Runs the periodic success rate and latency analysis until Stop is called
+func (d *OutlierDetector) Start() {
+	if d == nil {
+		return
+	}
+
+	for range d.ticker.C {
+		d.analyze()
+	}
+}
+
+func (d *OutlierDetector) Stop() {
+	if d == nil {
+		return
+	}
+	d.ticker.Stop()
+}
+
+// Compares the backends that served enough requests over the last interval and ejects those
+// whose success rate or latency stands out, then starts a new interval
+func (d *OutlierDetector) analyze() {
+	d.mu.Lock()
+	stats := d.stats
+	d.stats = make(map[*backend.Backend]*outlierStats, len(stats))
+
+	// Runs in progress carry over to the next interval
+	for b, st := range stats {
+		d.stats[b] = &outlierStats{consecutive: st.consecutive, gateway: st.gateway}
+	}
+	d.mu.Unlock()
+
+	candidates := make([]*backend.Backend, 0, len(stats))
+	rates := make([]float64, 0, len(stats))
+	latencies := make([]float64, 0, len(stats))
+	for _, b := range d.pool.GetBackends() {
+		b.ForgiveEjection(time.Duration(d.cfg.MaxEjection) * time.Second)
+
+		st, ok := stats[b]
+		if !ok || st.requests < int(d.cfg.MinRequests) {
+			continue
+		}
+		candidates = append(candidates, b)
+		rates = append(rates, float64(st.successes)/float64(st.requests))
+		latencies = append(latencies, float64(st.latency)/float64(st.requests))
+	}
+
+	if len(candidates) < int(d.cfg.MinHosts) {
+		return
+	}
+
+	mean, stdev := meanStdev(rates)
+	minRate := mean - d.cfg.SuccessRateStdev*stdev
+	maxLatency := median(latencies) * d.cfg.LatencyFactor
+
+	for i, b := range candidates {
+		switch {
+		case rates[i] < minRate:
+			d.eject(b, fmt.Sprintf("success rate %.1f%% below the pool threshold of %.1f%%", rates[i]*100, minRate*100))
+		case latencies[i] > maxLatency:
+			d.eject(b, fmt.Sprintf("average latency %s above the pool threshold of %s", time.Duration(latencies[i]), time.Duration(maxLatency)))
+		}
+	}
+}
+
+// Ejects b unless that would take more than the allowed share of the pool out of rotation.
+// One backend may always be ejected so small pools are covered too.
+func (d *OutlierDetector) eject(b *backend.Backend, reason string) {
+	d.ejectMu.Lock()
+	defer d.ejectMu.Unlock()
+
+	backends := d.pool.GetBackends()
+
+	ejected := 0
+	for _, be := range backends {
+		if be.IsEjected() {
+			if be == b {
+				return
+			}
+			ejected++
+		}
+	}
+
+	if ejected > 0 && float64(ejected+1) > float64(len(backends))*float64(d.cfg.MaxEjectionPercent)/100 {
+		atomic.AddInt64(&d.metrics.Outlier.Skipped, 1)
+		return
+	}
+
+	b.Eject(time.Duration(d.cfg.BaseEjection)*time.Second, time.Duration(d.cfg.MaxEjection)*time.Second, reason)
+	atomic.AddInt64(&d.metrics.Outlier.Ejections, 1)
+}
+
+func meanStdev(values []float64) (float64, float64) {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
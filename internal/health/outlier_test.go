@@ -0,0 +1,223 @@
+package health
+
+import (
+	"fmt"
+	"math"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+	"proxymity/internal/metrics"
+	"testing"
+	"time"
+)
+
+func newOutlierDetector(n int, cfg config.OutlierConfig) (*OutlierDetector, []*backend.Backend) {
+	m := metrics.NewMetrics()
+	pool := backend.NewPool(m)
+
+	backends := make([]*backend.Backend, n)
+	for i := range backends {
+		backends[i] = &backend.Backend{Name: fmt.Sprintf("b%d", i)}
+		backends[i].SetAlive(true)
+		pool.AddBackend(backends[i])
+	}
+
+	cfg.Enabled = true
+	cfg.Interval = 10
+	cfg.BaseEjection = 30
+	cfg.MaxEjection = 300
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = 100
+	}
+
+	d := NewOutlierDetector(cfg, pool, m)
+	d.Stop()
+	return d, backends
+}
+
+func TestObserveConsecutive(t *testing.T) {
+	tests := []struct {
+		name     string
+		consec   uint
+		gateway  uint
+		statuses []int
+		want     bool
+	}{
+		{name: "5xx in a row", consec: 3, gateway: 10, statuses: []int{500, 501, 500}, want: true},
+		{name: "5xx run broken by a success", consec: 3, gateway: 10, statuses: []int{500, 500, 200, 500}},
+		{name: "4xx breaks the run", consec: 2, gateway: 10, statuses: []int{500, 404, 500}},
+		{name: "gateway errors in a row", consec: 10, gateway: 2, statuses: []int{0, 504}, want: true},
+		{name: "other 5xx breaks the gateway run", consec: 10, gateway: 2, statuses: []int{502, 500, 0}},
+		{name: "gateway statuses count as 5xx", consec: 2, gateway: 10, statuses: []int{503, 502}, want: true},
+		{name: "connection errors are not 5xx", consec: 2, gateway: 10, statuses: []int{0, 0, 0}},
+		{name: "connection errors and 5xx mixed", consec: 2, gateway: 10, statuses: []int{500, 0, 500}, want: true},
+	}
+
+	for _, tt := range tests {
+		d, backends := newOutlierDetector(3, config.OutlierConfig{Consecutive5xx: tt.consec, ConsecutiveGateway: tt.gateway})
+
+		for _, status := range tt.statuses {
+			d.Observe(backends[0], status, time.Millisecond)
+		}
+
+		if got := backends[0].IsEjected(); got != tt.want {
+			t.Errorf("%s: ejected = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeanStdev(t *testing.T) {
+	tests := []struct {
+		values              []float64
+		wantMean, wantStdev float64
+	}{
+		{values: []float64{1, 1, 1, 1}, wantMean: 1, wantStdev: 0},
+		{values: []float64{2, 4, 4, 4, 5, 5, 7, 9}, wantMean: 5, wantStdev: 2},
+		{values: []float64{1, 1, 1, 1, 0.5}, wantMean: 0.9, wantStdev: 0.2},
+	}
+
+	for _, tt := range tests {
+		mean, stdev := meanStdev(tt.values)
+		if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(stdev-tt.wantStdev) > 1e-9 {
+			t.Errorf("meanStdev(%v) = %v, %v, want %v, %v", tt.values, mean, stdev, tt.wantMean, tt.wantStdev)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{values: []float64{3}, want: 3},
+		{values: []float64{5, 1, 3}, want: 3},
+		{values: []float64{4, 1, 3, 2}, want: 2.5},
+	}
+
+	for _, tt := range tests {
+		values := append([]float64(nil), tt.values...)
+		if got := median(values); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+		for i := range values {
+			if values[i] != tt.values[i] {
+				t.Fatalf("median(%v) reordered its input", tt.values)
+			}
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	// Every backend serves 100 requests of 10ms with no failures unless overridden
+	type traffic struct {
+		failures int
+		latency  time.Duration
+	}
+
+	tests := []struct {
+		name     string
+		minHosts uint
+		traffic  map[int]traffic
+		want     []bool
+	}{
+		{
+			name:     "low success rate",
+			minHosts: 5,
+			traffic:  map[int]traffic{4: {failures: 50}},
+			want:     []bool{false, false, false, false, true},
+		},
+		{
+			name:     "high latency",
+			minHosts: 5,
+			traffic:  map[int]traffic{2: {latency: 50 * time.Millisecond}},
+			want:     []bool{false, false, true, false, false},
+		},
+		{
+			name:     "spread within the thresholds",
+			minHosts: 5,
+			traffic:  map[int]traffic{1: {failures: 2}, 2: {failures: 1}, 3: {failures: 1, latency: 25 * time.Millisecond}},
+			want:     []bool{false, false, false, false, false},
+		},
+		{
+			name:     "too few hosts to compare",
+			minHosts: 6,
+			traffic:  map[int]traffic{4: {failures: 50}},
+			want:     []bool{false, false, false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		d, backends := newOutlierDetector(5, config.OutlierConfig{
+			Consecutive5xx:     1000,
+			ConsecutiveGateway: 1000,
+			SuccessRateStdev:   1.9,
+			LatencyFactor:      3,
+			MinHosts:           tt.minHosts,
+			MinRequests:        100,
+		})
+
+		for i, b := range backends {
+			tr := tt.traffic[i]
+			latency := tr.latency
+			if latency == 0 {
+				latency = 10 * time.Millisecond
+			}
+			for n := 0; n < 100; n++ {
+				status := 200
+				if n < tr.failures {
+					status = 500
+				}
+				d.Observe(b, status, latency)
+			}
+		}
+
+		d.analyze()
+
+		for i, b := range backends {
+			if got := b.IsEjected(); got != tt.want[i] {
+				t.Errorf("%s: %s ejected = %v, want %v", tt.name, b.Name, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestEjectCap(t *testing.T) {
+	tests := []struct {
+		name        string
+		backends    int
+		percent     uint
+		ejections   int
+		wantEjected int
+		wantSkipped int64
+	}{
+		{name: "within the cap", backends: 10, percent: 20, ejections: 2, wantEjected: 2},
+		{name: "over the cap", backends: 10, percent: 20, ejections: 4, wantEjected: 2, wantSkipped: 2},
+		{name: "one always allowed", backends: 3, percent: 10, ejections: 2, wantEjected: 1, wantSkipped: 1},
+		{name: "everything allowed", backends: 3, percent: 100, ejections: 3, wantEjected: 3},
+	}
+
+	for _, tt := range tests {
+		d, backends := newOutlierDetector(tt.backends, config.OutlierConfig{MaxEjectionPercent: tt.percent})
+
+		for i := 0; i < tt.ejections; i++ {
+			d.eject(backends[i], "test")
+		}
+		// Ejecting a backend that is already out changes nothing
+		d.eject(backends[0], "test")
+
+		ejected := 0
+		for _, b := range backends {
+			if b.IsEjected() {
+				ejected++
+			}
+		}
+		if ejected != tt.wantEjected {
+			t.Errorf("%s: %d backends ejected, want %d", tt.name, ejected, tt.wantEjected)
+		}
+		if got := d.metrics.Outlier.Skipped; got != tt.wantSkipped {
+			t.Errorf("%s: %d ejections skipped, want %d", tt.name, got, tt.wantSkipped)
+		}
+		if got := backends[0].Ejections(); got != 1 {
+			t.Errorf("%s: first backend ejected %d times in a row, want 1", tt.name, got)
+		}
+	}
+}
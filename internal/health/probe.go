@@ -0,0 +1,225 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Largest response body read when the probe inspects it
+const maxProbeBody = 64 << 10
+
+// Probe checks a backend once and returns why it is unhealthy, or nil if it passed
+type Probe interface {
+	Check(ctx context.Context, b *backend.Backend) error
+}
+
+// Builds the probe of a validated backend health check configuration
+func NewProbe(cfg config.HealthProbeConfig) Probe {
+	switch cfg.Type {
+	case "tcp":
+		return &tcpProbe{port: cfg.Port}
+	case "tls":
+		return &tlsProbe{port: cfg.Port, serverName: cfg.ServerName, insecure: cfg.InsecureSkipVerify}
+	case "grpc":
+		return newGRPCProbe(cfg)
+	case "exec":
+		return &execProbe{command: cfg.Command}
+	}
+	return newHTTPProbe(cfg)
+}
+
+// Returns the host:port a probe connects to, port overrides the one of the backend URL
+func probeAddress(u *url.URL, port string) string {
+	if port == "" {
+		port = u.Port()
+	}
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Sends an HTTP request and inspects the status and body of the response
+type httpProbe struct {
+	client    *http.Client
+	method    string
+	headers   http.Header
+	host      string
+	port      string
+	statuses  [][2]int
+	body      string
+	bodyRegex *regexp.Regexp
+	jsonPath  []string
+	jsonValue string
+}
+
+func newHTTPProbe(cfg config.HealthProbeConfig) *httpProbe {
+	p := &httpProbe{
+		client:    &http.Client{},
+		method:    cfg.Method,
+		headers:   make(http.Header, len(cfg.Headers)),
+		host:      cfg.Host,
+		port:      cfg.Port,
+		body:      cfg.Body,
+		jsonValue: cfg.JSONValue,
+	}
+	if p.method == "" {
+		p.method = http.MethodGet
+	}
+
+	for name, value := range cfg.Headers {
+		p.headers.Set(name, value)
+	}
+
+	for _, s := range cfg.Statuses {
+		p.statuses = append(p.statuses, parseStatusRange(s))
+	}
+	if len(p.statuses) == 0 {
+		p.statuses = [][2]int{{http.StatusOK, http.StatusOK}}
+	}
+
+	if cfg.BodyRegex != "" {
+		p.bodyRegex = regexp.MustCompile(cfg.BodyRegex)
+	}
+	if cfg.JSONPath != "" {
+		p.jsonPath = strings.Split(cfg.JSONPath, ".")
+	}
+	return p
+}
+
+// Parses "204", "2xx" or "200-399" into an inclusive range
+func parseStatusRange(s string) [2]int {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		class := int(s[0]-'0') * 100
+		return [2]int{class, class + 99}
+	}
+
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		l, _ := strconv.Atoi(lo)
+		h, _ := strconv.Atoi(hi)
+		return [2]int{l, h}
+	}
+
+	code, _ := strconv.Atoi(s)
+	return [2]int{code, code}
+}
+
+func (p *httpProbe) Check(ctx context.Context, b *backend.Backend) error {
+	target := b.Host.JoinPath(b.Health)
+	if p.port != "" {
+		target.Host = probeAddress(target, p.port)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.method, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = p.headers.Clone()
+	if p.host != "" {
+		req.Host = p.host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read and discard the rest of the body to allow connection reuse
+	defer io.Copy(io.Discard, resp.Body)
+
+	if !p.acceptsStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if p.body == "" && p.bodyRegex == nil && p.jsonPath == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return err
+	}
+	return p.checkBody(body)
+}
+
+func (p *httpProbe) acceptsStatus(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *httpProbe) checkBody(body []byte) error {
+	if p.body != "" && !strings.Contains(string(body), p.body) {
+		return fmt.Errorf("body does not contain %q", p.body)
+	}
+
+	if p.bodyRegex != nil && !p.bodyRegex.Match(body) {
+		return fmt.Errorf("body does not match %q", p.bodyRegex)
+	}
+
+	if p.jsonPath == nil {
+		return nil
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("body is not valid JSON: %w", err)
+	}
+
+	value, err := lookupJSON(doc, p.jsonPath)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return fmt.Errorf("%s is null", strings.Join(p.jsonPath, "."))
+	}
+	if p.jsonValue != "" && fmt.Sprint(value) != p.jsonValue {
+		return fmt.Errorf("%s is %v, expected %s", strings.Join(p.jsonPath, "."), value, p.jsonValue)
+	}
+	return nil
+}
+
+// Follows a dotted path through decoded JSON, numeric segments index into arrays
+func lookupJSON(doc any, path []string) (any, error) {
+	for i, key := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", strings.Join(path[:i+1], "."))
+			}
+			doc = v
+		case []any:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("%s not found", strings.Join(path[:i+1], "."))
+			}
+			doc = node[idx]
+		default:
+			parent := strings.Join(path[:i], ".")
+			if parent == "" {
+				parent = "document"
+			}
+			return nil, errors.New(parent + " is not an object or array")
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"encoding/json"
+	"proxymity/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [2]int
+	}{
+		{"204", [2]int{204, 204}},
+		{"2xx", [2]int{200, 299}},
+		{"3XX", [2]int{300, 399}},
+		{"200-399", [2]int{200, 399}},
+	}
+
+	for _, tt := range tests {
+		if got := parseStatusRange(tt.in); got != tt.want {
+			t.Errorf("parseStatusRange(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptsStatus(t *testing.T) {
+	p := &httpProbe{statuses: [][2]int{parseStatusRange("2xx"), parseStatusRange("301")}}
+
+	for code, want := range map[int]bool{200: true, 299: true, 301: true, 302: false, 404: false, 199: false} {
+		if got := p.acceptsStatus(code); got != want {
+			t.Errorf("acceptsStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestLookupJSON(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"status":"up","checks":{"db":{"ok":true}},"items":[{"id":1},{"id":2}],"empty":null}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		want    any
+		wantErr string
+	}{
+		{path: "status", want: "up"},
+		{path: "checks.db.ok", want: true},
+		{path: "items.1.id", want: 2.0},
+		{path: "empty", want: nil},
+		{path: "missing", wantErr: "missing not found"},
+		{path: "checks.cache", wantErr: "checks.cache not found"},
+		{path: "items.2", wantErr: "items.2 not found"},
+		{path: "items.x", wantErr: "items.x not found"},
+		{path: "status.x", wantErr: "status is not an object or array"},
+	}
+
+	for _, tt := range tests {
+		got, err := lookupJSON(doc, strings.Split(tt.path, "."))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("lookupJSON(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookupJSON(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupJSONScalarDocument(t *testing.T) {
+	if _, err := lookupJSON("up", []string{"status"}); err == nil || err.Error() != "document is not an object or array" {
+		t.Errorf("lookupJSON on a scalar error = %v", err)
+	}
+}
+
+func TestCheckBody(t *testing.T) {
+	p := newHTTPProbe(config.HealthProbeConfig{Body: "ok", JSONPath: "checks.db", JSONValue: "up"})
+
+	tests := []struct {
+		body    string
+		wantErr bool
+	}{
+		{`{"checks":{"db":"up"},"msg":"ok"}`, false},
+		{`{"checks":{"db":"down"},"msg":"ok"}`, true},
+		{`{"checks":{"db":"up"}}`, true},
+		{`not json ok`, true},
+	}
+
+	for _, tt := range tests {
+		if err := p.checkBody([]byte(tt.body)); (err != nil) != tt.wantErr {
+			t.Errorf("checkBody(%s) error = %v, want error %v", tt.body, err, tt.wantErr)
+		}
+	}
+}
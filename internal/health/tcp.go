@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"proxymity/internal/backend"
+)
+
+// Passes when a TCP connection to the backend can be opened
+type tcpProbe struct {
+	port string
+}
+
+func (p *tcpProbe) Check(ctx context.Context, b *backend.Backend) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", probeAddress(b.Host, p.port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Passes when a TLS handshake with the backend succeeds, which includes verifying its
+// certificate unless insecure is set
+type tlsProbe struct {
+	port       string
+	serverName string
+	insecure   bool
+}
+
+func (p *tlsProbe) Check(ctx context.Context, b *backend.Backend) error {
+	serverName := p.serverName
+	if serverName == "" {
+		serverName = b.Host.Hostname()
+	}
+
+	d := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: p.insecure,
+		},
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", probeAddress(b.Host, p.port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,6 @@
+package metrics
+
+type CircuitBreakerMetrics struct {
+	Trips    int64 // Times a backend circuit opened
+	Rejected int64 // Requests turned away by an open or saturated half-open circuit
+}
@@ -1,21 +1,27 @@
 package metrics
 
 type Metrics struct {
-	Traffic      *TrafficMetrics
-	Latency      *LatencyMetrics
-	Error        *ErrorMetrics
-	Backend      *BackendMetrics
-	LoadBalancer *LoadBalancerMetrics
-	Resource     *ResourceMetrics
+	Traffic        *TrafficMetrics
+	Latency        *LatencyMetrics
+	Error          *ErrorMetrics
+	Backend        *BackendMetrics
+	LoadBalancer   *LoadBalancerMetrics
+	Resource       *ResourceMetrics
+	Retry          *RetryMetrics
+	CircuitBreaker *CircuitBreakerMetrics
+	Outlier        *OutlierMetrics
 }
 
 func NewMetrics() *Metrics {
 	return &Metrics{
-		Traffic:      &TrafficMetrics{},
-		Latency:      &LatencyMetrics{},
-		Error:        &ErrorMetrics{},
-		Backend:      &BackendMetrics{},
-		LoadBalancer: &LoadBalancerMetrics{RequestsPerBackend: make(map[string]int64)},
-		Resource:     &ResourceMetrics{},
+		Traffic:        &TrafficMetrics{},
+		Latency:        &LatencyMetrics{},
+		Error:          &ErrorMetrics{},
+		Backend:        &BackendMetrics{},
+		LoadBalancer:   &LoadBalancerMetrics{RequestsPerBackend: make(map[string]int64)},
+		Resource:       &ResourceMetrics{},
+		Retry:          &RetryMetrics{},
+		CircuitBreaker: &CircuitBreakerMetrics{},
+		Outlier:        &OutlierMetrics{},
 	}
-}
\ No newline at end of file
+}
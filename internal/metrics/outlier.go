@@ -0,0 +1,6 @@
+package metrics
+
+type OutlierMetrics struct {
+	Ejections int64 // Backends ejected by outlier detection
+	Skipped   int64 // Ejections skipped because too many backends were already ejected
+}
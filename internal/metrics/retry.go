@@ -0,0 +1,6 @@
+package metrics
+
+type RetryMetrics struct {
+	Retries         int64 // Requests sent again to another backend
+	BudgetExhausted int64 // Retries denied because the retry budget was spent
+}
@@ -1,59 +1,355 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"proxymity/internal/accesslog"
+	"proxymity/internal/backend"
 	loadbalancer "proxymity/internal/balancer"
+	"proxymity/internal/config"
+	"proxymity/internal/forwarded"
+	"proxymity/internal/headers"
+	"proxymity/internal/health"
 	"proxymity/internal/metrics"
+	"proxymity/internal/requestid"
+	"proxymity/internal/retry"
+	"proxymity/internal/rewrite"
+	"proxymity/internal/sticky"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Proxy struct {
-	lb loadbalancer.LoadBalancer
-	m  *metrics.Metrics
+	lb        loadbalancer.LoadBalancer
+	m         *metrics.Metrics
+	sticky    *sticky.Sessions
+	headers   *headers.Rules
+	forwarded *forwarded.Resolver
+	retry     *retry.Policy
+	outliers  *health.OutlierDetector
 }
 
-func NewProxy(lb loadbalancer.LoadBalancer, m *metrics.Metrics) *Proxy {
-	return &Proxy{lb: lb}
+// Optional behaviour of a proxy, nil fields are disabled
+type Options struct {
+	Sticky    *sticky.Sessions        // Session affinity
+	Headers   *headers.Rules          // Global header rules
+	Forwarded *forwarded.Resolver     // Forwarding headers, defaults to trusting no proxy
+	Retry     *retry.Policy           // Retries on other backends, defaults to a single attempt
+	Outliers  *health.OutlierDetector // Passive health checking
+}
+
+// Creates a proxy forwarding to backends picked by lb
+func NewProxy(lb loadbalancer.LoadBalancer, m *metrics.Metrics, opts Options) *Proxy {
+	fwd := opts.Forwarded
+	if fwd == nil {
+		fwd, _ = forwarded.New(nil)
+	}
+	rp := opts.Retry
+	if rp == nil {
+		rp = retry.New(config.RetryConfig{
+			Attempts: 1,
+			Budget:   config.RetryBudgetConfig{Ratio: new(float64), MinPerSecond: new(uint)},
+		}, m)
+	}
+
+	return &Proxy{
+		lb:        lb,
+		m:         m,
+		sticky:    opts.Sticky,
+		headers:   opts.Headers,
+		forwarded: fwd,
+		retry:     rp,
+		outliers:  opts.Outliers,
+	}
 }
 
 func (p *Proxy) Proxy() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		req := c.Request
+		retryable, err := p.retry.Prepare(req)
+		if err != nil {
+			p.localResponse(c)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "could not read request body",
+				"details":    err.Error(),
+				"request_id": requestid.FromContext(req.Context()),
+			})
+			return
+		}
+
+		p.retry.Request()
+
 		var (
-			lastErr  error
-			tried    int
-			maxTries = p.lb.CountAvailableBackends()
+			lastErr   error
+			held      *heldResponse
+			exhausted bool
+			attempts  int
+			tried     = make(map[*backend.Backend]bool)
 		)
-		for tried < maxTries {
-			backend, err := p.lb.NextBackend()
+		for attempt := 0; attempt < p.retry.Attempts(); attempt++ {
+			if attempt > 0 {
+				// Never replay once the client got part of a response or went away
+				if !retryable || c.Writer.Written() || req.Context().Err() != nil {
+					break
+				}
+				if !p.retry.Allow() {
+					exhausted = true
+					break
+				}
+				if !p.retry.Backoff(req.Context(), attempt) {
+					break
+				}
+				if err := retry.Rewind(req); err != nil {
+					break
+				}
+			}
+
+			b, probe, err := p.pick(req, tried, attempt == 0)
 			if err != nil {
-				lastErr = err
+				if lastErr == nil {
+					lastErr = err
+				}
 				break
 			}
 
-			proxy := httputil.NewSingleHostReverseProxy(backend.Host)
+			// The retry is only charged to the budget once it is certain to be sent
+			if attempt > 0 && !p.retry.Spend() {
+				b.ReleaseAdmission(probe)
+				exhausted = true
+				break
+			}
+			tried[b] = true
+			attempts++
+
+			// Retried statuses are only intercepted while another attempt can still answer. Only the
+			// backends a retry could pick count, the route's own filters included.
+			last := !retryable || attempt+1 >= p.retry.Attempts() || p.lb.CountAvailableBackends(untried(req, tried)) == 0
+
+			vars := Vars(req, b)
+			routeRules := headers.FromContext(req.Context())
+
+			proxy := &httputil.ReverseProxy{}
+			proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+				pr.SetURL(b.Host)
+				pr.Out.Host = pr.In.Host
+				p.forwarded.SetHeaders(pr.Out, pr.In)
+
+				p.headers.ApplyRequest(pr.Out.Header, vars)
+				routeRules.ApplyRequest(pr.Out.Header, vars)
+				b.Headers.ApplyRequest(pr.Out.Header, vars)
+			}
+			var (
+				status           int
+				failed, canceled bool
+			)
+			proxy.ModifyResponse = func(resp *http.Response) error {
+				status = resp.StatusCode
+				failed = resp.StatusCode >= http.StatusInternalServerError
+
+				// The proxy already echoes its own request ID
+				resp.Header.Del(requestid.Header)
+
+				// Pinned clients get their cookie again, so the session only expires once idle for the TTL
+				if p.sticky != nil {
+					p.sticky.Pin(resp.Header, b)
+				}
+				rewrite.Response(resp, b.Host)
+				p.headers.ApplyResponse(resp.Header, vars)
+				routeRules.ApplyResponse(resp.Header, vars)
+				b.Headers.ApplyResponse(resp.Header, vars)
+
+				// The response is kept aside and written through if no retry follows after all
+				if !last && p.retry.RetryStatus(resp.StatusCode) {
+					if h, ok := hold(resp); ok {
+						held = h
+						return &retry.StatusError{Code: resp.StatusCode}
+					}
+				}
+				return nil
+			}
 			proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-				log.Printf("Error proxying to %s: %v", backend.Name, err)
-				backend.SetAlive(false)
+				log.Printf("Error proxying %s to %s: %v", requestid.FromContext(r.Context()), b.Name, err)
+
+				// A retried status was already judged, and a client hanging up says nothing about the backend
+				var se *retry.StatusError
+				if !errors.As(err, &se) {
+					canceled = errors.Is(err, context.Canceled)
+					failed = !canceled
+				}
 				lastErr = err
 			}
 
-			proxy.ServeHTTP(c.Writer, c.Request)
-			backend.AddConnection()
+			lastErr = nil
+			serve(proxy, b, c, req, func(latency time.Duration) {
+				if canceled {
+					b.ReleaseAdmission(probe)
+					return
+				}
+				b.ReportResult(!failed, probe)
+				p.outliers.Observe(b, status, latency)
+			})
 
 			// If no error was set by ErrorHandler, request succeeded
 			if lastErr == nil {
 				return
 			}
 
-			tried++
+			if !retry.Retryable(lastErr) {
+				break
+			}
 		}
+
+		if c.Writer.Written() {
+			return
+		}
+
+		// A real backend answer beats a synthetic one
+		if held != nil {
+			held.write(c.Writer)
+			return
+		}
+
 		// If we reach here, all attempts failed
+		details := ""
+		if lastErr != nil {
+			details = lastErr.Error()
+		}
+		p.localResponse(c)
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":   "all backends failed",
-			"details": lastErr.Error(),
+			"error":                  "all backends failed",
+			"details":                details,
+			"attempts":               attempts,
+			"request_id":             requestid.FromContext(req.Context()),
+			"retry_budget_exhausted": exhausted,
 		})
 	}
 }
+
+// Largest response body kept aside while a retried status is retried
+const maxHeldBody = 64 << 10
+
+// A backend response with a retried status, held back until it is known whether a retry follows
+type heldResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Reads resp into memory. Responses larger than maxHeldBody are left to stream to the client,
+// with the part already read put back in front of their body.
+func hold(resp *http.Response) (*heldResponse, bool) {
+	if resp.ContentLength > maxHeldBody {
+		return nil, false
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxHeldBody+1))
+	if err != nil || len(buf) > maxHeldBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+		return nil, false
+	}
+
+	return &heldResponse{status: resp.StatusCode, header: resp.Header.Clone(), body: buf}, true
+}
+
+func (h *heldResponse) write(w http.ResponseWriter) {
+	for name, values := range h.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(h.status)
+	w.Write(h.body)
+}
+
+// Picks the backend of an attempt, only the first one honors the session cookie. Retries are
+// steered away from the backends that already failed the request, and backends whose circuit
+// breaker turns the request away are marked as tried so the balancer moves on. The results are
+// the backend and whether it is a circuit probe.
+func (p *Proxy) pick(req *http.Request, tried map[*backend.Backend]bool, first bool) (*backend.Backend, bool, error) {
+	if p.sticky != nil && first {
+		if b := p.sticky.Backend(req); b != nil {
+			if ok, probe := b.Admit(); ok {
+				return b, probe, nil
+			}
+			tried[b] = true
+		}
+	}
+
+	r := req
+	if len(tried) > 0 {
+		r = untried(req, tried)
+	}
+	for {
+		b, err := p.lb.NextBackend(r)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok, probe := b.Admit(); ok {
+			return b, probe, nil
+		}
+		if len(tried) == 0 {
+			r = untried(req, tried)
+		}
+		tried[b] = true
+	}
+}
+
+// Restricts the backend selection of r to the backends not in tried. Requests that have not
+// excluded any backend yet go without, so balancers can skip the filtering pass.
+func untried(r *http.Request, tried map[*backend.Backend]bool) *http.Request {
+	return loadbalancer.WithFilter(r, func(b *backend.Backend) bool { return !tried[b] })
+}
+
+// Reports the retry policy and its budget usage
+func (p *Proxy) Stats() map[string]any {
+	return p.retry.Stats()
+}
+
+// Forwards the request while keeping the backend's in-flight counter and latency average accurate, then calls done.
+// The deferred release also runs when ReverseProxy aborts the handler with http.ErrAbortHandler.
+func serve(proxy *httputil.ReverseProxy, b *backend.Backend, c *gin.Context, r *http.Request, done func(time.Duration)) {
+	start := time.Now()
+	b.StartRequest()
+	defer func() {
+		latency := time.Since(start)
+		b.ObserveLatency(latency)
+		b.EndRequest()
+		done(latency)
+		accesslog.FromContext(r.Context()).Attempt(b.Name, latency)
+	}()
+
+	proxy.ServeHTTP(c.Writer, r)
+}
+
+// Applies the global and route response rules to an answer the proxy writes itself
+func (p *Proxy) localResponse(c *gin.Context) {
+	vars := Vars(c.Request, nil)
+	p.headers.ApplyResponse(c.Writer.Header(), vars)
+	headers.FromContext(c.Request.Context()).ApplyResponse(c.Writer.Header(), vars)
+}
+
+// Returns the values header rules can reference for a request sent to b, b is nil for answers
+// the proxy writes itself
+func Vars(r *http.Request, b *backend.Backend) headers.Vars {
+	name := ""
+	if b != nil {
+		name = b.Name
+	}
+
+	return headers.Vars{
+		"client_ip":    forwarded.ClientIP(r),
+		"backend_name": name,
+		"request_id":   requestid.FromContext(r.Context()),
+		"host":         r.Host,
+		"method":       r.Method,
+		"path":         r.URL.Path,
+		"scheme":       forwarded.Scheme(r),
+	}
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"proxymity/internal/backend"
+	loadbalancer "proxymity/internal/balancer"
+	"proxymity/internal/config"
+	"proxymity/internal/metrics"
+	"proxymity/internal/retry"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHold(t *testing.T) {
+	small := strings.Repeat("x", 100)
+	large := strings.Repeat("y", maxHeldBody+1)
+
+	tests := []struct {
+		name     string
+		body     string
+		length   int64
+		wantHeld bool
+	}{
+		{name: "small body", body: small, length: int64(len(small)), wantHeld: true},
+		{name: "empty body", body: "", length: 0, wantHeld: true},
+		{name: "small body of unknown length", body: small, length: -1, wantHeld: true},
+		{name: "body at the limit", body: large[1:], length: maxHeldBody, wantHeld: true},
+		{name: "announced large body", body: large, length: int64(len(large))},
+		{name: "large body of unknown length", body: large, length: -1},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode:    http.StatusServiceUnavailable,
+			Header:        http.Header{"Content-Type": {"text/plain"}, "Retry-After": {"1"}},
+			Body:          io.NopCloser(strings.NewReader(tt.body)),
+			ContentLength: tt.length,
+		}
+
+		held, ok := hold(resp)
+		if ok != tt.wantHeld {
+			t.Fatalf("%s: hold() = %v, want %v", tt.name, ok, tt.wantHeld)
+		}
+
+		if !ok {
+			// The response streams to the client as if it was never touched
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("%s: streamed body has %d bytes, want %d", tt.name, len(got), len(tt.body))
+			}
+			continue
+		}
+
+		// Headers changed after holding do not leak into the held copy
+		resp.Header.Set("Retry-After", "99")
+
+		w := httptest.NewRecorder()
+		held.write(w)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: written status = %d, want 503", tt.name, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != "1" {
+			t.Errorf("%s: written Retry-After = %q, want 1", tt.name, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("%s: written Content-Type = %q, want text/plain", tt.name, got)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: written body has %d bytes, want %d", tt.name, w.Body.Len(), len(tt.body))
+		}
+	}
+}
+
+func TestRetriedStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		minPerSecond uint
+		wantStatus   int
+		wantBody     string
+		wantCalls    int
+	}{
+		{name: "retry answers", statuses: []int{503, 200}, minPerSecond: 10, wantStatus: 200, wantBody: "b1", wantCalls: 2},
+		{name: "last backend streams", statuses: []int{503, 503}, minPerSecond: 10, wantStatus: 503, wantBody: "b1", wantCalls: 2},
+		{name: "held answer written through", statuses: []int{503, 200}, wantStatus: 503, wantBody: "b0", wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		m := metrics.NewMetrics()
+		pool := backend.NewPool(m)
+
+		calls := 0
+		for i, status := range tt.statuses {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(status)
+				fmt.Fprintf(w, "b%d", i)
+			}))
+			defer srv.Close()
+
+			u, _ := url.Parse(srv.URL)
+			b := &backend.Backend{Name: fmt.Sprintf("b%d", i), Host: u}
+			b.SetAlive(true)
+			pool.AddBackend(b)
+		}
+
+		rp := retry.New(config.RetryConfig{
+			Attempts: 3,
+			Statuses: []int{503},
+			Budget:   config.RetryBudgetConfig{Ratio: new(float64), MinPerSecond: &tt.minPerSecond, Window: 10},
+		}, m)
+		p := NewProxy(loadbalancer.NewRoundRobin(pool), m, Options{Retry: rp})
+
+		router := gin.New()
+		router.NoRoute(p.Proxy())
+
+		front := httptest.NewServer(router)
+		defer front.Close()
+
+		resp, err := http.Get(front.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: backends called %d times, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Header carrying the request ID to backends and back to clients
+const Header = "X-Request-ID"
+
+// Longest incoming ID accepted before a new one is generated instead
+const maxLength = 128
+
+// Returns a new UUIDv7: a 48-bit millisecond timestamp followed by random bits, so IDs sort
+// by creation time
+func New() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16|uint64(binary.BigEndian.Uint16(u[6:8])))
+	u[6] = 0x70 | u[6]&0x0f // version 7
+	u[8] = 0x80 | u[8]&0x3f // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Returns the ID the request should carry: the incoming one when trusted is true and the
+// value is sane, a freshly generated one otherwise
+func Resolve(r *http.Request, trusted bool) string {
+	if id := r.Header.Get(Header); trusted && valid(id) {
+		return id
+	}
+	return New()
+}
+
+// Accepts non-empty printable ASCII without spaces, so IDs are safe to log and echo
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type idKey struct{}
+
+// Returns a shallow copy of r carrying the request ID in its context and header
+func Attach(r *http.Request, id string) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), idKey{}, id))
+	r.Header.Set(Header, id)
+	return r
+}
+
+// Returns the request ID attached by Attach, empty when there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
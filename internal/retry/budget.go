@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget limits retries to a ratio of the requests seen over a sliding window, on top of a
+// fixed allowance per second. The window is split in one second buckets that expire in turn.
+type Budget struct {
+	mu      sync.Mutex
+	ratio   float64
+	reserve float64
+	buckets []bucket
+}
+
+type bucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func NewBudget(ratio float64, minPerSecond uint, window time.Duration) *Budget {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &Budget{
+		ratio:   ratio,
+		reserve: float64(minPerSecond) * float64(seconds),
+		buckets: make([]bucket, seconds),
+	}
+}
+
+// Records a request entering the proxy
+func (b *Budget) Request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current().requests++
+}
+
+// Reports whether a retry is left in the budget without spending it
+func (b *Budget) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.available()
+}
+
+// Spends a retry from the budget, returns false without spending anything when none is left
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.available() {
+		return false
+	}
+
+	b.current().retries++
+	return true
+}
+
+func (b *Budget) available() bool {
+	requests, retries := b.totals()
+	return float64(retries+1) <= max(b.ratio*float64(requests), b.reserve)
+}
+
+// Returns the requests and retries counted over the window
+func (b *Budget) Totals() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.totals()
+}
+
+// Returns the bucket of the current second, recycling it if it holds an expired second
+func (b *Budget) current() *bucket {
+	now := time.Now().Unix()
+	bk := &b.buckets[now%int64(len(b.buckets))]
+	if bk.second != now {
+		*bk = bucket{second: now}
+	}
+	return bk
+}
+
+func (b *Budget) totals() (int, int) {
+	oldest := time.Now().Unix() - int64(len(b.buckets))
+
+	requests, retries := 0, 0
+	for _, bk := range b.buckets {
+		if bk.second > oldest {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	return requests, retries
+}
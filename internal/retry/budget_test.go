@@ -0,0 +1,108 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+// Spends retries until the budget refuses, bounded so a broken budget cannot hang the test
+func drain(b *Budget) int {
+	n := 0
+	for n < 10000 && b.Withdraw() {
+		n++
+	}
+	return n
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		ratio        float64
+		minPerSecond uint
+		window       time.Duration
+		requests     int
+		want         int
+	}{
+		{name: "ratio", ratio: 0.2, window: 10 * time.Second, requests: 100, want: 20},
+		{name: "ratio rounds down", ratio: 0.25, window: 10 * time.Second, requests: 10, want: 2},
+		{name: "reserve over the window", minPerSecond: 3, window: 10 * time.Second, requests: 5, want: 30},
+		{name: "ratio above the reserve", ratio: 0.5, minPerSecond: 1, window: 2 * time.Second, requests: 10, want: 5},
+		{name: "reserve above the ratio", ratio: 0.1, minPerSecond: 1, window: 5 * time.Second, requests: 20, want: 5},
+		{name: "window shorter than a second", minPerSecond: 2, window: 0, want: 2},
+		{name: "nothing allowed", window: 10 * time.Second, requests: 1000, want: 0},
+	}
+
+	for _, tt := range tests {
+		b := NewBudget(tt.ratio, tt.minPerSecond, tt.window)
+		for range tt.requests {
+			b.Request()
+		}
+
+		if got := drain(b); got != tt.want {
+			t.Errorf("%s: %d retries allowed, want %d", tt.name, got, tt.want)
+		}
+		if _, retries := b.Totals(); retries != tt.want {
+			t.Errorf("%s: %d retries counted, want %d", tt.name, retries, tt.want)
+		}
+	}
+}
+
+func TestBudgetAvailableDoesNotSpend(t *testing.T) {
+	b := NewBudget(0, 1, time.Second)
+
+	for range 3 {
+		if !b.Available() {
+			t.Fatal("Available() = false with an unused reserve")
+		}
+	}
+	if !b.Withdraw() {
+		t.Fatal("Withdraw() = false after Available() calls")
+	}
+	if b.Available() || b.Withdraw() {
+		t.Error("budget still has a retry after spending the only one")
+	}
+}
+
+func TestBudgetExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		age  int64
+		want int
+	}{
+		{name: "current second", age: 0, want: 4},
+		{name: "oldest second of the window", age: 2, want: 4},
+		{name: "expired", age: 3, want: 0},
+	}
+
+	for _, tt := range tests {
+		// Buckets are keyed by wall clock seconds, a case that straddled two seconds is run again
+		for {
+			start := time.Now().Unix()
+
+			b := NewBudget(0.5, 0, 3*time.Second)
+			for range 10 {
+				b.Request()
+			}
+			b.Withdraw()
+
+			// Age the traffic as if it was recorded tt.age seconds ago, in the slot of that second
+			aged := make([]bucket, len(b.buckets))
+			for _, bk := range b.buckets {
+				if bk.second != 0 {
+					bk.second -= tt.age
+					aged[bk.second%int64(len(aged))] = bk
+				}
+			}
+			b.buckets = aged
+
+			got := drain(b)
+			if time.Now().Unix() != start {
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("%s: %d retries allowed, want %d", tt.name, got, tt.want)
+			}
+			break
+		}
+	}
+}
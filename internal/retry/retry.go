@@ -0,0 +1,221 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"proxymity/internal/config"
+	"proxymity/internal/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// Methods that can be sent twice without changing the outcome, RFC 9110 section 9.2.2
+var idempotent = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Policy decides whether a failed request may be sent again to another backend
+type Policy struct {
+	attempts    int
+	maxBodySize int64
+	methods     map[string]bool
+	statuses    map[int]bool
+	budget      *Budget
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	exhausted   int64
+	metrics     *metrics.Metrics
+}
+
+func New(cfg config.RetryConfig, m *metrics.Metrics) *Policy {
+	p := &Policy{
+		attempts:    int(cfg.Attempts),
+		maxBodySize: int64(cfg.MaxBodySize),
+		methods:     make(map[string]bool, len(cfg.Methods)),
+		statuses:    make(map[int]bool, len(cfg.Statuses)),
+		budget:      NewBudget(*cfg.Budget.Ratio, *cfg.Budget.MinPerSecond, time.Duration(cfg.Budget.Window)*time.Second),
+		backoffBase: time.Duration(cfg.Backoff.Base) * time.Millisecond,
+		backoffMax:  time.Duration(cfg.Backoff.Max) * time.Millisecond,
+		metrics:     m,
+	}
+	if p.attempts < 1 {
+		p.attempts = 1
+	}
+
+	for _, m := range cfg.Methods {
+		p.methods[m] = true
+	}
+	for _, code := range cfg.Statuses {
+		p.statuses[code] = true
+	}
+	return p
+}
+
+// Returns the number of tries a request gets, including the first one
+func (p *Policy) Attempts() int {
+	return p.attempts
+}
+
+// Records a request in the retry budget, every request handled by the proxy must be counted
+func (p *Policy) Request() {
+	p.budget.Request()
+}
+
+// Reports whether the budget has a retry left. The retry is only spent by Spend, once nothing
+// can abort it anymore.
+func (p *Policy) Allow() bool {
+	if !p.budget.Available() {
+		p.exhaust()
+		return false
+	}
+	return true
+}
+
+// Takes a retry from the budget and reports whether one was still left
+func (p *Policy) Spend() bool {
+	if !p.budget.Withdraw() {
+		p.exhaust()
+		return false
+	}
+
+	atomic.AddInt64(&p.metrics.Retry.Retries, 1)
+	return true
+}
+
+func (p *Policy) exhaust() {
+	atomic.AddInt64(&p.exhausted, 1)
+	atomic.AddInt64(&p.metrics.Retry.BudgetExhausted, 1)
+}
+
+// Waits before retry n, counting from 1, for a random duration up to the exponential backoff
+// cap. Full jitter keeps retries of requests that failed together from arriving together.
+// Returns false if ctx ended first.
+func (p *Policy) Backoff(ctx context.Context, n int) bool {
+	ceiling := p.backoffMax
+	if n < 32 {
+		ceiling = min(ceiling, p.backoffBase<<(n-1))
+	}
+	if ceiling <= 0 {
+		return ctx.Err() == nil
+	}
+
+	t := time.NewTimer(rand.N(ceiling))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Reports the retry budget usage over the current window
+func (p *Policy) Stats() map[string]any {
+	requests, retries := p.budget.Totals()
+
+	return map[string]any{
+		"attempts":         p.attempts,
+		"window_requests":  requests,
+		"window_retries":   retries,
+		"budget_exhausted": atomic.LoadInt64(&p.exhausted),
+	}
+}
+
+// Reports whether requests with this method may be retried
+func (p *Policy) AllowsMethod(method string) bool {
+	return idempotent[method] || p.methods[method]
+}
+
+// Reports whether a backend response with this status is retried on another backend
+func (p *Policy) RetryStatus(code int) bool {
+	return p.statuses[code]
+}
+
+// Prepares r to be sent more than once and reports whether it may be retried. Bodies up to
+// the configured size are read into memory and exposed through r.GetBody, larger ones keep
+// streaming from the client and rule out retries since they can only be sent once.
+func (p *Policy) Prepare(r *http.Request) (bool, error) {
+	if p.attempts < 2 || !p.AllowsMethod(r.Method) {
+		return false, nil
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		r.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return true, nil
+	}
+
+	if r.ContentLength > p.maxBodySize {
+		return false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, p.maxBodySize+1))
+	if err != nil {
+		return false, err
+	}
+
+	// Chunked bodies may turn out larger than the limit, hand back what was read in front of the rest
+	if int64(len(buf)) > p.maxBodySize {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return false, nil
+	}
+
+	r.Body.Close()
+	r.ContentLength = int64(len(buf))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(buf)), nil }
+	r.Body, _ = r.GetBody()
+	return true, nil
+}
+
+// Restores the body of a request prepared for retries so it can be sent again
+func Rewind(r *http.Request) error {
+	if r.GetBody == nil {
+		return nil
+	}
+
+	body, err := r.GetBody()
+	if err != nil {
+		return err
+	}
+	r.Body = body
+	return nil
+}
+
+// StatusError reports a backend response whose status the policy retries
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("backend responded with status %d", e.Code)
+}
+
+// Reports whether err is worth trying again on another backend: the connection could not be
+// established, so the backend never saw the request, or it answered with a retried status
+func Retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return true
+	}
+	return IsConnectError(err)
+}
+
+// Reports whether err happened while connecting to the backend
+func IsConnectError(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
@@ -0,0 +1,185 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"proxymity/internal/config"
+	"proxymity/internal/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPolicy(attempts, maxBodySize uint, methods ...string) *Policy {
+	return New(config.RetryConfig{
+		Attempts:    attempts,
+		MaxBodySize: maxBodySize,
+		Methods:     methods,
+		Statuses:    []int{502, 503},
+		Budget:      config.RetryBudgetConfig{Ratio: new(float64), MinPerSecond: new(uint), Window: 10},
+	}, metrics.NewMetrics())
+}
+
+func TestAllowsMethod(t *testing.T) {
+	p := newPolicy(3, 1024, "POST")
+
+	tests := map[string]bool{
+		"GET":     true,
+		"HEAD":    true,
+		"OPTIONS": true,
+		"TRACE":   true,
+		"PUT":     true,
+		"DELETE":  true,
+		"POST":    true,
+		"PATCH":   false,
+		"CONNECT": false,
+	}
+
+	for method, want := range tests {
+		if got := p.AllowsMethod(method); got != want {
+			t.Errorf("AllowsMethod(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+// Hides the length of a body, the way chunked uploads arrive
+type unsized struct {
+	io.Reader
+}
+
+func (unsized) Close() error { return nil }
+
+func TestPrepare(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        *Policy
+		method        string
+		body          string
+		chunked       bool
+		wantRetryable bool
+	}{
+		{name: "no body", policy: newPolicy(3, 8), method: "GET", wantRetryable: true},
+		{name: "small body", policy: newPolicy(3, 8), method: "PUT", body: "12345678", wantRetryable: true},
+		{name: "small chunked body", policy: newPolicy(3, 8), method: "PUT", body: "1234", chunked: true, wantRetryable: true},
+		{name: "body over the limit", policy: newPolicy(3, 8), method: "PUT", body: "123456789"},
+		{name: "chunked body over the limit", policy: newPolicy(3, 8), method: "PUT", body: "123456789", chunked: true},
+		{name: "non idempotent", policy: newPolicy(3, 8), method: "POST", body: "1"},
+		{name: "non idempotent allowed", policy: newPolicy(3, 8, "POST"), method: "POST", body: "1", wantRetryable: true},
+		{name: "single attempt", policy: newPolicy(1, 8), method: "GET"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+		if tt.body == "" {
+			r.Body = http.NoBody
+		}
+		if tt.chunked {
+			r.Body = unsized{strings.NewReader(tt.body)}
+			r.ContentLength = -1
+		}
+
+		retryable, err := tt.policy.Prepare(r)
+		if err != nil {
+			t.Fatalf("%s: Prepare() error = %v", tt.name, err)
+		}
+		if retryable != tt.wantRetryable {
+			t.Errorf("%s: Prepare() = %v, want %v", tt.name, retryable, tt.wantRetryable)
+		}
+
+		// Whatever Prepare decided, the first send gets the whole body
+		if got := readBody(t, r); got != tt.body {
+			t.Errorf("%s: first body = %q, want %q", tt.name, got, tt.body)
+		}
+
+		if !retryable {
+			continue
+		}
+		for i := 0; i < 2; i++ {
+			if err := Rewind(r); err != nil {
+				t.Fatalf("%s: Rewind() error = %v", tt.name, err)
+			}
+			if got := readBody(t, r); got != tt.body {
+				t.Errorf("%s: replayed body = %q, want %q", tt.name, got, tt.body)
+			}
+		}
+		if tt.body != "" && r.ContentLength != int64(len(tt.body)) {
+			t.Errorf("%s: ContentLength = %d, want %d", tt.name, r.ContentLength, len(tt.body))
+		}
+	}
+}
+
+func readBody(t *testing.T, r *http.Request) string {
+	t.Helper()
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "retried status", err: &StatusError{Code: 503}, want: true},
+		{name: "dial error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "read error", err: &net.OpError{Op: "read", Err: errors.New("connection reset")}},
+		{name: "other error", err: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		base, max uint
+		n         int
+		canceled  bool
+		want      bool
+		maxWait   time.Duration
+	}{
+		{name: "disabled", n: 1, want: true, maxWait: 5 * time.Millisecond},
+		{name: "first retry under base", base: 10, max: 1000, n: 1, want: true, maxWait: 10 * time.Millisecond},
+		{name: "capped by max", base: 10, max: 20, n: 40, want: true, maxWait: 20 * time.Millisecond},
+		{name: "canceled while waiting", base: 1000, max: 1000, n: 3, canceled: true, maxWait: 5 * time.Millisecond},
+		{name: "canceled without backoff", n: 1, canceled: true, maxWait: 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		p := New(config.RetryConfig{
+			Attempts: 3,
+			Budget:   config.RetryBudgetConfig{Ratio: new(float64), MinPerSecond: new(uint), Window: 10},
+			Backoff:  config.RetryBackoffConfig{Base: tt.base, Max: tt.max},
+		}, metrics.NewMetrics())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if tt.canceled {
+			cancel()
+		}
+
+		start := time.Now()
+		got := p.Backoff(ctx, tt.n)
+		waited := time.Since(start)
+		cancel()
+
+		if got != tt.want {
+			t.Errorf("%s: Backoff() = %v, want %v", tt.name, got, tt.want)
+		}
+		// The timer may fire a little late, the slack only guards against uncapped waits
+		if waited > tt.maxWait+50*time.Millisecond {
+			t.Errorf("%s: waited %v, want at most %v", tt.name, waited, tt.maxWait)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package rewrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"proxymity/internal/config"
+	"proxymity/internal/forwarded"
+	"regexp"
+	"strings"
+)
+
+// Rewriter maps public request paths onto the layout the backends expect, and optionally
+// maps Location and Set-Cookie paths in responses back onto the public layout
+type Rewriter struct {
+	strip       string
+	add         string
+	re          *regexp.Regexp
+	replacement string
+	location    bool
+	cookiePath  bool
+}
+
+// Builds a rewriter from its configuration, nil when the configuration rewrites nothing
+func New(cfg config.RewriteConfig) (*Rewriter, error) {
+	if cfg == (config.RewriteConfig{}) {
+		return nil, nil
+	}
+
+	rw := &Rewriter{
+		strip:       strings.TrimSuffix(cfg.StripPrefix, "/"),
+		add:         strings.TrimSuffix(cfg.AddPrefix, "/"),
+		replacement: cfg.Replacement,
+		location:    cfg.RewriteLocation,
+		cookiePath:  cfg.RewriteCookiePath,
+	}
+
+	if cfg.Regex != "" {
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite regex %q: %w", cfg.Regex, err)
+		}
+		rw.re = re
+	}
+
+	return rw, nil
+}
+
+// Rewrites a public path for the backend: strips the prefix, applies the regex replacement
+// (which may reference capture groups as $1 or ${name}) and prepends the added prefix
+func (rw *Rewriter) Path(p string) string {
+	if rw.strip != "" {
+		if rest, ok := cutPathPrefix(p, rw.strip); ok {
+			p = rest
+		}
+	}
+
+	if rw.re != nil {
+		p = rw.re.ReplaceAllString(p, rw.replacement)
+	}
+
+	if rw.add != "" {
+		p = rw.add + p
+	}
+
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// Maps a backend path back onto the public layout. Regex replacements cannot be inverted,
+// so paths are left untouched when one is configured.
+func (rw *Rewriter) reversePath(p string) string {
+	if rw.re != nil {
+		return p
+	}
+
+	if rw.add != "" {
+		rest, ok := cutPathPrefix(p, rw.add)
+		if !ok {
+			return p
+		}
+		p = rest
+	}
+
+	if rw.strip != "" {
+		if p == "/" {
+			return rw.strip
+		}
+		p = rw.strip + p
+	}
+	return p
+}
+
+// Rewrites the Location and Set-Cookie headers of a backend response so they point at the
+// public URL layout. Absolute locations are only touched when they point at the backend, or at
+// the public host the proxy forwarded to it.
+func (rw *Rewriter) response(h http.Header, backendURL *url.URL, publicScheme, publicHost string) {
+	if rw.location {
+		if loc := h.Get("Location"); loc != "" {
+			if u, err := url.Parse(loc); err == nil && (u.Host == "" || u.Host == backendURL.Host || u.Host == publicHost) {
+				if u.Host != "" {
+					u.Scheme, u.Host = publicScheme, publicHost
+				}
+				if strings.HasPrefix(u.Path, "/") {
+					setEscapedPath(u, rw.reversePath(u.EscapedPath()))
+				}
+				h.Set("Location", u.String())
+			}
+		}
+	}
+
+	if rw.cookiePath {
+		cookies := h.Values("Set-Cookie")
+		if len(cookies) == 0 {
+			return
+		}
+
+		h.Del("Set-Cookie")
+		for _, line := range cookies {
+			c, err := http.ParseSetCookie(line)
+			if err != nil || c.Path == "" {
+				h.Add("Set-Cookie", line)
+				continue
+			}
+			c.Path = rw.reversePath(c.Path)
+			h.Add("Set-Cookie", c.String())
+		}
+	}
+}
+
+// Cuts prefix off p only at a path segment boundary, so "/api" matches "/api" and "/api/x" but not "/apix"
+func cutPathPrefix(p, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(p, prefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return p, false
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	return rest, true
+}
+
+type applied struct {
+	rw     *Rewriter
+	scheme string
+	host   string
+}
+
+type appliedKey struct{}
+
+// Returns a shallow copy of r with its path rewritten for the backend. The rewriter is kept in
+// the request context so Response can restore the public layout on the way back.
+func (rw *Rewriter) Apply(r *http.Request) *http.Request {
+	scheme := forwarded.Scheme(r)
+
+	ctx := context.WithValue(r.Context(), appliedKey{}, applied{rw: rw, scheme: scheme, host: r.Host})
+	out := r.Clone(ctx)
+
+	p, query := rw.Target(r.URL)
+	setEscapedPath(out.URL, p)
+	out.URL.RawQuery = query
+	return out
+}
+
+// Returns the escaped path and raw query the backend receives for a request to u
+func (rw *Rewriter) Target(u *url.URL) (string, string) {
+	// Rewrite the escaped form so encoded characters like %2F and %3F stay encoded
+	p := rw.Path(u.EscapedPath())
+	query := u.RawQuery
+
+	// A regex replacement may introduce a query string, merge it with the original one. A "?"
+	// in the escaped path can only come from the replacement.
+	if rw.re != nil && strings.Contains(rw.replacement, "?") {
+		if path, added, ok := strings.Cut(p, "?"); ok {
+			p = path
+			if query != "" {
+				added += "&" + query
+			}
+			query = added
+		}
+	}
+	return p, query
+}
+
+// Sets the path of u from its escaped form, keeping the escaping the client chose
+func setEscapedPath(u *url.URL, escaped string) {
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		u.Path, u.RawPath = escaped, ""
+		return
+	}
+	u.Path, u.RawPath = path, escaped
+}
+
+// Rewrites the headers of a backend response if the request it answers was rewritten by Apply
+func Response(resp *http.Response, backendURL *url.URL) {
+	a, ok := resp.Request.Context().Value(appliedKey{}).(applied)
+	if !ok {
+		return
+	}
+	a.rw.response(resp.Header, backendURL, a.scheme, a.host)
+}
@@ -0,0 +1,171 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"proxymity/internal/config"
+	"proxymity/internal/forwarded"
+	"testing"
+)
+
+func mustNew(t *testing.T, cfg config.RewriteConfig) *Rewriter {
+	t.Helper()
+	rw, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rw
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RewriteConfig
+		in   string
+		want string
+	}{
+		{"strip", config.RewriteConfig{StripPrefix: "/api"}, "/api/users", "/users"},
+		{"strip whole path", config.RewriteConfig{StripPrefix: "/api"}, "/api", "/"},
+		{"strip only at segment boundary", config.RewriteConfig{StripPrefix: "/api"}, "/apix/users", "/apix/users"},
+		{"strip trailing slash", config.RewriteConfig{StripPrefix: "/api/"}, "/api/users", "/users"},
+		{"add", config.RewriteConfig{AddPrefix: "/v2"}, "/users", "/v2/users"},
+		{"strip and add", config.RewriteConfig{StripPrefix: "/api/users", AddPrefix: "/v2"}, "/api/users/42", "/v2/42"},
+		{"regex", config.RewriteConfig{Regex: "^/u/([0-9]+)$", Replacement: "/users/$1"}, "/u/42", "/users/42"},
+		{"regex without match", config.RewriteConfig{Regex: "^/u/([0-9]+)$", Replacement: "/users/$1"}, "/u/me", "/u/me"},
+		{"regex named group", config.RewriteConfig{Regex: "^/(?P<id>[0-9]+)$", Replacement: "/items/${id}"}, "/7", "/items/7"},
+		{"leading slash restored", config.RewriteConfig{Regex: "^/", Replacement: ""}, "/users", "/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustNew(t, tt.cfg).Path(tt.in); got != tt.want {
+				t.Errorf("Path(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReversePath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RewriteConfig
+		in   string
+		want string
+	}{
+		{"strip", config.RewriteConfig{StripPrefix: "/api"}, "/users", "/api/users"},
+		{"strip root", config.RewriteConfig{StripPrefix: "/api"}, "/", "/api"},
+		{"add", config.RewriteConfig{AddPrefix: "/v2"}, "/v2/users", "/users"},
+		{"add mismatch", config.RewriteConfig{AddPrefix: "/v2"}, "/other", "/other"},
+		{"strip and add", config.RewriteConfig{StripPrefix: "/api/users", AddPrefix: "/v2"}, "/v2/42", "/api/users/42"},
+		{"regex is not inverted", config.RewriteConfig{StripPrefix: "/api", Regex: "^/u$", Replacement: "/users"}, "/users", "/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustNew(t, tt.cfg).reversePath(tt.in); got != tt.want {
+				t.Errorf("reversePath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.RewriteConfig
+		target    string
+		wantPath  string
+		wantRaw   string
+		wantQuery string
+	}{
+		{"prefix keeps query", config.RewriteConfig{StripPrefix: "/api"}, "/api/a?x=1", "/a", "/a", "x=1"},
+		{"encoded question mark stays in the path", config.RewriteConfig{StripPrefix: "/api"}, "/api/a%3Fb", "/a?b", "/a%3Fb", ""},
+		{"encoded slash stays encoded", config.RewriteConfig{StripPrefix: "/api"}, "/api/a%2Fb/c", "/a/b/c", "/a%2Fb/c", ""},
+		{"replacement adds a query", config.RewriteConfig{Regex: "^/u/([0-9]+)$", Replacement: "/users?id=$1"}, "/u/42?x=1", "/users", "/users", "id=42&x=1"},
+		{"replacement without query", config.RewriteConfig{Regex: "^/u/(.+)$", Replacement: "/users/$1"}, "/u/a%3Fb", "/users/a?b", "/users/a%3Fb", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := mustNew(t, tt.cfg).Apply(httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if out.URL.Path != tt.wantPath || out.URL.EscapedPath() != tt.wantRaw || out.URL.RawQuery != tt.wantQuery {
+				t.Errorf("Apply(%q) = path %q, escaped %q, query %q, want %q, %q, %q",
+					tt.target, out.URL.Path, out.URL.EscapedPath(), out.URL.RawQuery, tt.wantPath, tt.wantRaw, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestResponseLocation(t *testing.T) {
+	backendURL, _ := url.Parse("http://10.0.0.1:8081")
+	rw := mustNew(t, config.RewriteConfig{StripPrefix: "/api", RewriteLocation: true, RewriteCookiePath: true})
+
+	tests := []struct {
+		name     string
+		location string
+		want     string
+	}{
+		{"relative", "/login", "/api/login"},
+		{"backend host", "http://10.0.0.1:8081/login", "https://example.com/api/login"},
+		{"public host", "https://example.com/login", "https://example.com/api/login"},
+		{"other host", "https://auth.example.org/login", "https://auth.example.org/login"},
+		{"escaping kept", "/a%2Fb", "/api/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Location": {tt.location}}
+			rw.response(h, backendURL, "https", "example.com")
+			if got := h.Get("Location"); got != tt.want {
+				t.Errorf("Location %q = %q, want %q", tt.location, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseCookiePath(t *testing.T) {
+	backendURL, _ := url.Parse("http://10.0.0.1:8081")
+	rw := mustNew(t, config.RewriteConfig{StripPrefix: "/api", RewriteCookiePath: true})
+
+	h := http.Header{"Set-Cookie": {"a=1; Path=/", "b=2"}}
+	rw.response(h, backendURL, "http", "example.com")
+
+	got := h.Values("Set-Cookie")
+	want := []string{"a=1; Path=/api", "b=2"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Set-Cookie = %q, want %q", got, want)
+	}
+}
+
+func TestResponseForwardedScheme(t *testing.T) {
+	fwd, err := forwarded.New([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := mustNew(t, config.RewriteConfig{StripPrefix: "/api", RewriteLocation: true})
+
+	tests := []struct {
+		name   string
+		remote string
+		want   string
+	}{
+		{"trusted TLS offload", "10.1.2.3:4000", "https://example.com/api/login"},
+		{"untrusted peer", "192.0.2.1:4000", "http://example.com/api/login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/api/x", nil)
+			r.RemoteAddr = tt.remote
+			r.Header.Set("X-Forwarded-Proto", "https")
+			out := rw.Apply(fwd.Annotate(r))
+
+			resp := &http.Response{Header: http.Header{"Location": {"http://example.com/login"}}, Request: out}
+			Response(resp, &url.URL{Scheme: "http", Host: "10.0.0.1:8081"})
+			if got := resp.Header.Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
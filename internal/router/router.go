@@ -0,0 +1,132 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"proxymity/internal/config"
+	"proxymity/internal/headers"
+	"proxymity/internal/rewrite"
+	"strings"
+)
+
+// Route sends the requests matching all of its conditions to an upstream group
+type Route struct {
+	Name     string
+	Upstream string
+	Rewrite  *rewrite.Rewriter // nil when the route forwards paths unchanged
+	Headers  *headers.Rules    // nil when the route has no header rules of its own
+
+	host       string
+	pathPrefix string
+	methods    map[string]bool
+	headers    map[string]string
+}
+
+// Router picks the upstream group of a request from an ordered list of routes, then from
+// the virtual hosts
+type Router struct {
+	routes        []*Route
+	vhosts        *VirtualHosts
+	fallback      *Route
+	unknownStatus int
+}
+
+// Creates a router evaluating routes in order. Requests matching none of them go to the
+// fallback upstream, or nowhere if fallback is empty.
+func New(routes []config.RouteConfig, fallback string) (*Router, error) {
+	rt := &Router{unknownStatus: http.StatusNotFound}
+
+	for _, rcfg := range routes {
+		r := &Route{
+			Name:       rcfg.Name,
+			Upstream:   rcfg.Upstream,
+			host:       strings.ToLower(rcfg.Match.Host),
+			pathPrefix: rcfg.Match.PathPrefix,
+			headers:    rcfg.Match.Headers,
+			Headers:    headers.New(rcfg.Headers),
+		}
+
+		rw, err := rewrite.New(rcfg.Rewrite)
+		if err != nil {
+			return nil, fmt.Errorf("route '%s': %w", rcfg.Name, err)
+		}
+		r.Rewrite = rw
+
+		if len(rcfg.Match.Methods) > 0 {
+			r.methods = make(map[string]bool, len(rcfg.Match.Methods))
+			for _, m := range rcfg.Match.Methods {
+				r.methods[strings.ToUpper(m)] = true
+			}
+		}
+
+		rt.routes = append(rt.routes, r)
+	}
+
+	if fallback != "" {
+		rt.fallback = &Route{Name: "default", Upstream: fallback}
+	}
+
+	return rt, nil
+}
+
+// Enables host based routing for requests no route matched. Once virtual hosts are set,
+// requests for unknown hosts go to their default vhost or are rejected with unknownStatus
+// instead of reaching the fallback upstream.
+func (rt *Router) SetVirtualHosts(vh *VirtualHosts, unknownStatus int) {
+	rt.vhosts = vh
+	rt.unknownStatus = unknownStatus
+}
+
+// Returns the first route matching the request, then the virtual host serving its Host
+// header, then the fallback route. False means nothing can serve the request.
+func (rt *Router) Match(r *http.Request) (*Route, bool) {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			return route, true
+		}
+	}
+
+	if rt.vhosts != nil {
+		return rt.vhosts.Match(r)
+	}
+
+	return rt.fallback, rt.fallback != nil
+}
+
+// Returns the status code for requests Match could not place: 404 for unrouted paths, or
+// the configured code (421 or 404) for unknown hosts
+func (rt *Router) UnknownStatus() int {
+	return rt.unknownStatus
+}
+
+func (route *Route) matches(r *http.Request) bool {
+	if route.host != "" && route.host != hostname(r.Host) {
+		return false
+	}
+
+	if route.pathPrefix != "" && !strings.HasPrefix(r.URL.Path, route.pathPrefix) {
+		return false
+	}
+
+	if route.methods != nil && !route.methods[r.Method] {
+		return false
+	}
+
+	// An empty value only requires the header to be present
+	for name, value := range route.headers {
+		got := r.Header.Get(name)
+		if (value == "" && got == "") || (value != "" && got != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Strips the port from a Host header value and lowercases it
+func hostname(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"proxymity/internal/config"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VirtualHosts maps the Host header of a request to an upstream group. Exact names win over
+// wildcards, the longest wildcard suffix wins among wildcards, and regular expressions
+// (patterns starting with "~") are tried last in declaration order, like nginx server_name.
+type VirtualHosts struct {
+	exact     map[string]*Route
+	wildcards []wildcardHost
+	regexps   []regexpHost
+	fallback  *Route
+}
+
+type wildcardHost struct {
+	suffix string
+	route  *Route
+}
+
+type regexpHost struct {
+	re    *regexp.Regexp
+	route *Route
+}
+
+// Builds the virtual host table. Unknown hosts go to the vhost named def, if any.
+func NewVirtualHosts(vhosts []config.VirtualHostConfig, def string) (*VirtualHosts, error) {
+	vh := &VirtualHosts{exact: make(map[string]*Route)}
+
+	for _, vcfg := range vhosts {
+		route := &Route{Name: vcfg.Name, Upstream: vcfg.Upstream}
+
+		for _, pattern := range vcfg.Hosts {
+			switch {
+			case strings.HasPrefix(pattern, "~"):
+				re, err := regexp.Compile(pattern[1:])
+				if err != nil {
+					return nil, fmt.Errorf("vhost '%s': invalid host regex %q: %w", vcfg.Name, pattern, err)
+				}
+				vh.regexps = append(vh.regexps, regexpHost{re: re, route: route})
+
+			case strings.HasPrefix(pattern, "*."):
+				vh.wildcards = append(vh.wildcards, wildcardHost{suffix: strings.ToLower(pattern[1:]), route: route})
+
+			default:
+				vh.exact[strings.ToLower(pattern)] = route
+			}
+		}
+
+		if vcfg.Name == def {
+			vh.fallback = route
+		}
+	}
+
+	sort.SliceStable(vh.wildcards, func(i, j int) bool {
+		return len(vh.wildcards[i].suffix) > len(vh.wildcards[j].suffix)
+	})
+
+	return vh, nil
+}
+
+// Returns the vhost serving the request host, the default vhost for unknown hosts, or false
+// when there is no default
+func (vh *VirtualHosts) Match(r *http.Request) (*Route, bool) {
+	host := hostname(r.Host)
+
+	if route, ok := vh.exact[host]; ok {
+		return route, true
+	}
+
+	for _, w := range vh.wildcards {
+		if strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return w.route, true
+		}
+	}
+
+	for _, rx := range vh.regexps {
+		if rx.re.MatchString(host) {
+			return rx.route, true
+		}
+	}
+
+	return vh.fallback, vh.fallback != nil
+}
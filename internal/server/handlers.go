@@ -2,8 +2,19 @@ package server
 
 import (
 	"net/http"
+	"proxymity/internal/accesslog"
 	"proxymity/internal/backend"
+	loadbalancer "proxymity/internal/balancer"
+	"proxymity/internal/config"
+	"proxymity/internal/forwarded"
+	"proxymity/internal/headers"
+	"proxymity/internal/metrics"
+	"proxymity/internal/proxy"
+	"proxymity/internal/requestid"
+	"proxymity/internal/router"
+	"proxymity/internal/upstream"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,26 +32,23 @@ func Health(c *gin.Context) {
 	})
 }
 
-// Status returns detailed status including backend information
-func Status(pool *backend.Pool) gin.HandlerFunc {
+// Status returns detailed status including backend and load balancer information for every upstream group
+func Status(upstreams []*upstream.Group, m *metrics.Metrics) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		backends := pool.GetBackends()
+		upstreamStatus := make([]gin.H, 0, len(upstreams))
+		defaultDetails := []gin.H{}
+		totalCount, healthyCount := 0, 0
 
-		// Collect backend status
-		backendStatus := make([]gin.H, 0, len(backends))
-		healthyCount := 0
+		for _, g := range upstreams {
+			status, details, healthy := groupStatus(g)
+			upstreamStatus = append(upstreamStatus, status)
+			totalCount += len(details)
+			healthyCount += healthy
 
-		for _, b := range backends {
-			isHealthy := b.IsAlive()
-			if isHealthy {
-				healthyCount++
+			// The top-level details keep describing the default upstream as they always did
+			if g.Name == config.DefaultUpstreamName {
+				defaultDetails = details
 			}
-
-			backendStatus = append(backendStatus, gin.H{
-				"name":    b.Name,
-				"url":     b.Host.String(),
-				"healthy": isHealthy,
-			})
 		}
 
 		// Determine overall status
@@ -50,15 +58,15 @@ func Status(pool *backend.Pool) gin.HandlerFunc {
 		if healthyCount == 0 {
 			overallStatus = "unhealthy"
 			statusCode = http.StatusServiceUnavailable
-		} else if healthyCount < len(backends) {
+		} else if healthyCount < totalCount {
 			overallStatus = "degraded"
 		} else {
 			overallStatus = "healthy"
 		}
 
 		// Get system stats
-		var m runtime.MemStats
-		runtime.ReadMemStats(&m)
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
 
 		c.JSON(statusCode, gin.H{
 			"status":    overallStatus,
@@ -66,19 +74,105 @@ func Status(pool *backend.Pool) gin.HandlerFunc {
 			"timestamp": time.Now().Unix(),
 			"uptime":    time.Since(startTime).Seconds(),
 			"backends": gin.H{
-				"total":   len(backends),
+				"total":   totalCount,
 				"healthy": healthyCount,
-				"details": backendStatus,
+				"details": defaultDetails,
+			},
+			"upstreams": upstreamStatus,
+			"retries": gin.H{
+				"total":            atomic.LoadInt64(&m.Retry.Retries),
+				"budget_exhausted": atomic.LoadInt64(&m.Retry.BudgetExhausted),
+			},
+			"circuit_breakers": gin.H{
+				"trips":    atomic.LoadInt64(&m.CircuitBreaker.Trips),
+				"rejected": atomic.LoadInt64(&m.CircuitBreaker.Rejected),
+			},
+			"outlier_detection": gin.H{
+				"ejections": atomic.LoadInt64(&m.Outlier.Ejections),
+				"skipped":   atomic.LoadInt64(&m.Outlier.Skipped),
 			},
 			"system": gin.H{
 				"goroutines":      runtime.NumGoroutine(),
-				"memory_usage_mb": float64(m.Alloc) / 1024 / 1024,
+				"memory_usage_mb": float64(mem.Alloc) / 1024 / 1024,
 				"cpu_count":       runtime.NumCPU(),
 			},
 		})
 	}
 }
 
+// Collects the status of a single upstream group along with its backend details and healthy count
+func groupStatus(g *upstream.Group) (gin.H, []gin.H, int) {
+	backends := g.Pool.GetBackends()
+
+	// Collect backend status
+	backendStatus := make([]gin.H, 0, len(backends))
+	healthyCount := 0
+
+	for _, b := range backends {
+		trips, rejected := b.CircuitStats()
+		isHealthy := b.IsAlive()
+		if isHealthy {
+			healthyCount++
+		}
+
+		backendStatus = append(backendStatus, gin.H{
+			"name":            b.Name,
+			"url":             b.Host.String(),
+			"healthy":         isHealthy,
+			"active_requests": b.ActiveRequests(),
+			"latency_ewma_ms": float64(b.LatencyEWMA()) / float64(time.Millisecond),
+			"score":           b.Cost() / float64(time.Millisecond),
+			"priority":        b.Priority,
+			"ramp_percent":    b.RampFactor() * 100,
+			"admin_state":     b.AdminState(),
+			"drained":         b.Drained(),
+			"ejected":         b.IsEjected(),
+			"ejections":       b.Ejections(),
+			"circuit": gin.H{
+				"state":    b.CircuitState(),
+				"trips":    trips,
+				"rejected": rejected,
+			},
+		})
+	}
+
+	// Collect failover tiers
+	tiers := g.Pool.Tiers()
+	tierStatus := make([]gin.H, 0, len(tiers))
+	activeTier := 0
+	for _, t := range tiers {
+		if t.Active {
+			activeTier = t.Priority
+		}
+		tierStatus = append(tierStatus, gin.H{
+			"priority": t.Priority,
+			"total":    t.Total,
+			"healthy":  t.Healthy,
+			"active":   t.Active,
+		})
+	}
+
+	balancerStatus := gin.H{}
+	if r, ok := g.Balancer.(loadbalancer.StatsReporter); ok {
+		balancerStatus = r.Stats()
+	}
+
+	return gin.H{
+		"name": g.Name,
+		"backends": gin.H{
+			"total":   len(backends),
+			"healthy": healthyCount,
+			"details": backendStatus,
+		},
+		"tiers": gin.H{
+			"active":  activeTier,
+			"details": tierStatus,
+		},
+		"load_balancer": balancerStatus,
+		"retry":         g.Proxy.Stats(),
+	}, backendStatus, healthyCount
+}
+
 // Config returns the current configuration settings
 func Config(config interface{}) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -89,3 +183,167 @@ func Config(config interface{}) gin.HandlerFunc {
 		})
 	}
 }
+
+// SetBackendState changes the admin state of a backend. Draining stops new requests while
+// letting in-flight ones finish, the backend reports "drained" once none are left.
+// Backend names only need to be unique within an upstream, the "upstream" query parameter
+// disambiguates between groups.
+func SetBackendState(upstreams []*upstream.Group) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var matches []*backend.Backend
+		for _, g := range upstreams {
+			if name := c.Query("upstream"); name != "" && name != g.Name {
+				continue
+			}
+			if b := g.Pool.GetBackend(c.Param("name")); b != nil {
+				matches = append(matches, b)
+			}
+		}
+
+		if len(matches) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "backend not found",
+			})
+			return
+		}
+		if len(matches) > 1 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "backend name exists in several upstreams, select one with ?upstream=",
+			})
+			return
+		}
+		b := matches[0]
+
+		var body struct {
+			State string `json:"state"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		state, err := backend.ParseAdminState(body.State)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		b.SetAdminState(state)
+
+		c.JSON(http.StatusOK, gin.H{
+			"name":            b.Name,
+			"admin_state":     b.AdminState(),
+			"active_requests": b.ActiveRequests(),
+			"drained":         b.Drained(),
+		})
+	}
+}
+
+// Dispatch forwards the request to the upstream group of the first matching route, rules are the
+// global header rules applied when no route matches
+func Dispatch(rt *router.Router, upstreams map[string]*upstream.Group, rules *headers.Rules) gin.HandlerFunc {
+	handlers := make(map[string]gin.HandlerFunc, len(upstreams))
+	for name, g := range upstreams {
+		handlers[name] = g.Proxy.Proxy()
+	}
+
+	return func(c *gin.Context) {
+		route, ok := rt.Match(c.Request)
+		if !ok {
+			rules.ApplyResponse(c.Writer.Header(), proxy.Vars(c.Request, nil))
+			c.JSON(rt.UnknownStatus(), gin.H{
+				"error": "no route matches the request",
+				"host":  c.Request.Host,
+			})
+			return
+		}
+
+		accesslog.FromContext(c.Request.Context()).SetUpstream(route.Upstream)
+
+		if route.Headers != nil {
+			c.Request = headers.WithRules(c.Request, route.Headers)
+		}
+		if route.Rewrite != nil {
+			c.Request = route.Rewrite.Apply(c.Request)
+		}
+
+		handlers[route.Upstream](c)
+	}
+}
+
+// DryRunRewrite reports which route a request would match and the exact path and query the backend
+// would receive, without forwarding anything. The request is described by the path, host and
+// method query parameters, plus any request headers sent to this endpoint.
+func DryRunRewrite(rt *router.Router) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.DefaultQuery("method", http.MethodGet)
+		path := c.DefaultQuery("path", "/")
+
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		r.Host = c.DefaultQuery("host", c.Request.Host)
+		r.Header = c.Request.Header.Clone()
+
+		route, ok := rt.Match(r)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"matched": false,
+				"status":  rt.UnknownStatus(),
+			})
+			return
+		}
+
+		// Same computation as the forwarded request, so escaping and added queries show up as sent
+		path, query := r.URL.EscapedPath(), r.URL.RawQuery
+		if route.Rewrite != nil {
+			path, query = route.Rewrite.Target(r.URL)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"matched":         true,
+			"route":           route.Name,
+			"upstream":        route.Upstream,
+			"original_path":   r.URL.EscapedPath(),
+			"original_query":  r.URL.RawQuery,
+			"rewritten_path":  path,
+			"rewritten_query": query,
+		})
+	}
+}
+
+// ResponseHeaders applies the global response header rules to the answers of local endpoints
+func ResponseHeaders(rules *headers.Rules) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules.ApplyResponse(c.Writer.Header(), proxy.Vars(c.Request, nil))
+		c.Next()
+	}
+}
+
+// ClientIP resolves the real client address of every request once, so balancing, header
+// rules and logging all see the same value
+func ClientIP(fwd *forwarded.Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = fwd.Annotate(c.Request)
+		c.Next()
+	}
+}
+
+// RequestID gives every request an ID, reusing the incoming one only when it was set by a
+// trusted proxy, and echoes it back to the client
+func RequestID(fwd *forwarded.Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestid.Resolve(c.Request, fwd.TrustsPeer(c.Request))
+		c.Request = requestid.Attach(c.Request, id)
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
@@ -5,22 +5,24 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
-	"proxymity/internal/backend"
-	loadbalancer "proxymity/internal/balancer"
+	"proxymity/internal/accesslog"
 	"proxymity/internal/config"
-	"proxymity/internal/health"
+	"proxymity/internal/forwarded"
+	"proxymity/internal/headers"
 	"proxymity/internal/metrics"
-	"proxymity/internal/proxy"
+	"proxymity/internal/router"
+	"proxymity/internal/upstream"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	proxy         *http.Server
-	pool          *backend.Pool
-	healthChecker *health.HealthChecker
-	metrics       *metrics.Metrics
+	proxy     *http.Server
+	admin     *http.Server
+	upstreams []*upstream.Group
+	accessLog *accesslog.Logger
+	metrics   *metrics.Metrics
 }
 
 // Create a new http server to receive requests and proxy the to the registered backends.
@@ -29,53 +31,103 @@ func New(cfg *config.Config) *Server {
 	// Setup metrics
 	m := metrics.NewMetrics()
 
-	// Create backend pool
-	pool := backend.NewPool(m)
-	for _, bcfg := range cfg.Backed {
-		parsedURL, err := url.Parse(bcfg.Host)
-		if err != nil {
-			// skip invalid backend URL
-			continue
-		}
-		b := &backend.Backend{
-			Name: bcfg.Name,
-			Host: parsedURL,
-		}
-		b.SetAlive(true)
-		pool.AddBackend(b)
+	// Setup client address resolution
+	fwd, err := forwarded.New(cfg.Proxy.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create upstream groups
+	upstreams := make([]*upstream.Group, 0)
+	byName := make(map[string]*upstream.Group)
+	for _, ucfg := range cfg.AllUpstreams() {
+		g := upstream.NewGroup(ucfg, cfg, fwd, m)
+		upstreams = append(upstreams, g)
+		byName[g.Name] = g
 	}
 
-	// Setup health checker
-	hc := health.NewHealthChecker(cfg.HealthCheck, pool, m)
+	// Setup routes, unmatched requests go to the default upstream if there is one
+	fallback := ""
+	if _, ok := byName[config.DefaultUpstreamName]; ok {
+		fallback = config.DefaultUpstreamName
+	}
+	rt, err := router.New(cfg.Routes, fallback)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Setup load balancer
-	lb := loadbalancer.ResolveMethod(cfg.LoadBalancer.Method, pool, m)
+	// Setup virtual hosts
+	if len(cfg.VirtualHosts.Hosts) > 0 {
+		vh, err := router.NewVirtualHosts(cfg.VirtualHosts.Hosts, cfg.VirtualHosts.Default)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rt.SetVirtualHosts(vh, cfg.VirtualHosts.UnknownStatus)
+	}
 
-	// Setup proxy
-	p := proxy.NewProxy(lb, m)
+	// Setup access log
+	al, err := accesslog.New(cfg.AccessLog)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Setup proxy router
-	pRouter := gin.Default()
-	pRouter.GET("/api/proxy/health", Health)
-	pRouter.GET("/api/proxy/status", Status(pool))
-	pRouter.GET("/api/proxy/config", Config(cfg))
-	pRouter.NoRoute(p.Proxy())
+	pRouter := gin.New()
+	if err := pRouter.SetTrustedProxies(cfg.Proxy.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
+	pRouter.Use(ClientIP(fwd), RequestID(fwd), al.Middleware(), gin.Recovery())
+	// Answers produced by the proxy itself get the global response header rules, proxied ones
+	// get them from the proxy once the backend responded
+	rules := headers.New(cfg.Headers)
+	api := pRouter.Group("/api/proxy", ResponseHeaders(rules))
+	api.GET("/health", Health)
+	api.GET("/status", Status(upstreams, m))
+	api.GET("/config", Config(cfg))
+	api.GET("/rewrite", DryRunRewrite(rt))
+	pRouter.NoRoute(Dispatch(rt, byName, rules))
+
+	// Setup admin router, kept off the proxy port since it can take backends out of rotation
+	aRouter := gin.New()
+	aRouter.Use(gin.Recovery())
+	aRouter.PUT("/api/proxy/backends/:name/state", SetBackendState(upstreams))
 
 	return &Server{
-		pool: pool,
+		upstreams: upstreams,
+		accessLog: al,
 		proxy: &http.Server{
 			Addr:    fmt.Sprintf("%s:%s", cfg.Proxy.Host, cfg.Proxy.Port),
 			Handler: pRouter,
 		},
-		healthChecker: hc,
-		metrics:       m,
+		admin: &http.Server{
+			Addr:    fmt.Sprintf("%s:%s", cfg.Proxy.Host, cfg.Proxy.AdminPort),
+			Handler: aRouter,
+		},
+		metrics: m,
 	}
 }
 
 func (s *Server) Start() error {
 
-	// Start health checker
-	go s.healthChecker.Start()
+	// Start health checkers, the first round of probes completes before traffic is accepted
+	var wg sync.WaitGroup
+	for _, g := range s.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.HealthChecker.Start()
+		}()
+		go g.Outliers.Start()
+	}
+	wg.Wait()
+
+	// Start admin server
+	go func() {
+		log.Printf("Starting admin server on %s", s.admin.Addr)
+		if err := s.admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin server failed: %v", err)
+		}
+	}()
 
 	// Start proxy server (blocking)
 	log.Printf("Starting proxy server on %s", s.proxy.Addr)
@@ -84,8 +136,20 @@ func (s *Server) Start() error {
 
 func (s *Server) Shutdown(ctx context.Context) error {
 
-	// Stoping health checker
-	s.healthChecker.Stop()
+	// Stoping health checkers
+	for _, g := range s.upstreams {
+		g.HealthChecker.Stop()
+		g.Outliers.Stop()
+	}
 
-	return s.proxy.Shutdown(ctx)
+	err := s.proxy.Shutdown(ctx)
+	if aerr := s.admin.Shutdown(ctx); err == nil {
+		err = aerr
+	}
+
+	// Flush and close access log sinks once no request can log anymore
+	if cerr := s.accessLog.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
@@ -0,0 +1,147 @@
+package sticky
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"proxymity/internal/backend"
+	"proxymity/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sessions pins clients to a backend through a signed cookie issued by the proxy
+type Sessions struct {
+	pool     *backend.Pool
+	name     string
+	path     string
+	ttl      time.Duration
+	sameSite http.SameSite
+	secure   bool
+	key      []byte
+}
+
+// Creates the sessions of one upstream group. Groups other than the default one suffix the cookie
+// name with their own name, so a client keeps its affinity in every group it talks to.
+func New(cfg config.StickySessionConfig, pool *backend.Pool, upstream string) *Sessions {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(cfg.SameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &Sessions{
+		pool:     pool,
+		name:     cookieName(cfg.Cookie, upstream),
+		path:     cfg.Path,
+		ttl:      time.Duration(cfg.TTL) * time.Second,
+		sameSite: sameSite,
+		secure:   cfg.Secure,
+		key:      []byte(cfg.Key),
+	}
+}
+
+// Returns the cookie name of an upstream group, characters not allowed in cookie names are
+// replaced with underscores
+func cookieName(base, upstream string) string {
+	if upstream == config.DefaultUpstreamName {
+		return base
+	}
+
+	suffix := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, upstream)
+	return base + "_" + suffix
+}
+
+// Returns the backend named by a valid, unexpired session cookie, or nil when the request
+// has no such cookie or the backend is not available anymore
+func (s *Sessions) Backend(r *http.Request) *backend.Backend {
+	c, err := r.Cookie(s.name)
+	if err != nil {
+		return nil
+	}
+
+	name, ok := s.verify(c.Value)
+	if !ok {
+		return nil
+	}
+
+	backends, err := s.pool.GetAvailableBackends()
+	if err != nil {
+		return nil
+	}
+
+	for _, b := range backends {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// Adds a cookie pinning the client to the backend to the response headers. Its expiry starts
+// over from now, so renewing it on every response makes the TTL an idle timeout.
+func (s *Sessions) Pin(h http.Header, b *backend.Backend) {
+	expires := time.Now().Add(s.ttl)
+
+	cookie := &http.Cookie{
+		Name:     s.name,
+		Value:    s.sign(b.Name, expires),
+		Path:     s.path,
+		Expires:  expires,
+		MaxAge:   int(s.ttl / time.Second),
+		Secure:   s.secure,
+		HttpOnly: true,
+		SameSite: s.sameSite,
+	}
+	h.Add("Set-Cookie", cookie.String())
+}
+
+// Cookie values have the form <base64 backend name>.<unix expiry>.<base64 HMAC-SHA256 of both>
+func (s *Sessions) sign(name string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(name)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s *Sessions) verify(value string) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := value[:i], value[i+1:]
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(payload)) {
+		return "", false
+	}
+
+	encodedName, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", false
+	}
+
+	name, err := base64.RawURLEncoding.DecodeString(encodedName)
+	if err != nil {
+		return "", false
+	}
+	return string(name), true
+}
+
+func (s *Sessions) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
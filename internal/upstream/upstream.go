@@ -0,0 +1,99 @@
+package upstream
+
+import (
+	"net/url"
+	"proxymity/internal/backend"
+	loadbalancer "proxymity/internal/balancer"
+	"proxymity/internal/config"
+	"proxymity/internal/forwarded"
+	"proxymity/internal/headers"
+	"proxymity/internal/health"
+	"proxymity/internal/metrics"
+	"proxymity/internal/proxy"
+	"proxymity/internal/retry"
+	"proxymity/internal/sticky"
+	"time"
+)
+
+// Group is a named set of backends with its own balancer, health checker and proxy
+type Group struct {
+	Name          string
+	Pool          *backend.Pool
+	Balancer      loadbalancer.LoadBalancer
+	HealthChecker *health.HealthChecker
+	Outliers      *health.OutlierDetector
+	Proxy         *proxy.Proxy
+}
+
+// Builds an upstream group from its configuration. Proxy-wide settings such as the local zone
+// and sticky sessions are taken from cfg, fwd is shared by every group.
+func NewGroup(ucfg config.UpstreamConfig, cfg *config.Config, fwd *forwarded.Resolver, m *metrics.Metrics) *Group {
+
+	// Create backend pool
+	cb := ucfg.Breaker
+	breaker := backend.BreakerSettings{
+		ConsecutiveFailures: int(*cb.ConsecutiveFailures),
+		FailureRatio:        cb.FailureRatio,
+		MinRequests:         int(cb.MinRequests),
+		Window:              time.Duration(cb.Window) * time.Second,
+		OpenDuration:        time.Duration(cb.OpenDuration) * time.Second,
+		HalfOpenRequests:    int(cb.HalfOpenRequests),
+	}
+	pool := backend.NewPool(m)
+	pool.SetFailoverThreshold(*ucfg.LoadBalancer.Failover)
+	for _, bcfg := range ucfg.Backends {
+		parsedURL, err := url.Parse(bcfg.Host)
+		if err != nil {
+			// skip invalid backend URL
+			continue
+		}
+		b := &backend.Backend{
+			Name:     bcfg.Name,
+			Host:     parsedURL,
+			Health:   bcfg.Health,
+			Priority: bcfg.Priority,
+			Zone:     bcfg.Zone,
+			Headers:  headers.New(bcfg.Headers),
+		}
+		b.SetWeight(bcfg.Weight)
+		if !*bcfg.Enabled {
+			b.SetAdminState(backend.StateDisabled)
+		}
+		b.SetLatencyDecay(time.Duration(ucfg.LoadBalancer.Decay) * time.Second)
+		b.SetSlowStart(time.Duration(ucfg.LoadBalancer.SlowStart) * time.Second)
+		b.SetCircuitBreaker(breaker)
+		pool.AddBackend(b)
+	}
+
+	// Setup health checker
+	hc := health.NewHealthChecker(ucfg.HealthCheck, ucfg.Backends, pool, m)
+	od := health.NewOutlierDetector(ucfg.Outlier, pool, m)
+
+	// Setup load balancer
+	lb := loadbalancer.ResolveMethod(ucfg.LoadBalancer, pool, m)
+	if cfg.Proxy.Zone != "" {
+		za := ucfg.LoadBalancer.ZoneAware
+		lb = loadbalancer.NewZoneAware(lb, pool, cfg.Proxy.Zone, *za.MinHealthy, za.Overload)
+	}
+
+	// Setup proxy
+	var s *sticky.Sessions
+	if cfg.Sticky.Enabled {
+		s = sticky.New(cfg.Sticky, pool, ucfg.Name)
+	}
+
+	return &Group{
+		Name:          ucfg.Name,
+		Pool:          pool,
+		Balancer:      lb,
+		HealthChecker: hc,
+		Outliers:      od,
+		Proxy: proxy.NewProxy(lb, m, proxy.Options{
+			Sticky:    s,
+			Headers:   headers.New(cfg.Headers),
+			Forwarded: fwd,
+			Retry:     retry.New(ucfg.Retry, m),
+			Outliers:  od,
+		}),
+	}
+}